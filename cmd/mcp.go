@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elsejj/gpt/internal/llm"
+	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/schema"
+	"github.com/elsejj/gpt/internal/tools"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/spf13/cobra"
+)
+
+// mcpCmd groups the subcommands about the model context protocol.
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "model context protocol commands",
+}
+
+var mcpServeCmd = &cobra.Command{
+	Use:   "serve [tool...]",
+	Short: "serve the tools as a mcp server",
+	Long: `Publish the tools in the tools folder of the config directory as mcp tools, or only the given ones.
+The input of a tool is a 'user' argument and its '${var}' placeholders, a call runs the tool with its
+model, system prompt and mcp servers. The action of a tool is not executed.
+It serves on stdio by default, '--http :8080' serves streamable HTTP at /mcp.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setLogLevel(0)
+		names := args
+		if len(names) == 0 {
+			var err error
+			if names, err = tools.List(); err != nil {
+				return err
+			}
+		}
+		s, err := tools.NewMCPServer(appVersion, names, runTool)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		addr, _ := cmd.Flags().GetString("http")
+		if addr == "" {
+			err := server.NewStdioServer(s).Listen(ctx, os.Stdin, os.Stdout)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+			return nil
+		}
+
+		httpServer := server.NewStreamableHTTPServer(s)
+		errs := make(chan error, 1)
+		go func() {
+			slog.Warn("serving mcp", "url", "http://"+addr+"/mcp", "tools", len(names))
+			errs <- httpServer.Start(addr)
+		}()
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		}
+	},
+}
+
+var mcpListToolsCmd = &cobra.Command{
+	Use:   "list-tools",
+	Short: "list the tools of the mcp servers",
+	Long: `List the tools of the mcp servers selected by '-M', with the names offered to the model.
+The arguments marked with '*' are required.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		servers, err := startMCPs(cmd)
+		if err != nil {
+			return err
+		}
+		defer servers.Shutdown()
+
+		infos := servers.ToolInfos()
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			return printJSON(infos)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSERVER\tARGUMENTS\tDESCRIPTION")
+		for _, info := range infos {
+			names := slices.Sorted(maps.Keys(info.Tool.InputSchema.Properties))
+			for i, name := range names {
+				if slices.Contains(info.Tool.InputSchema.Required, name) {
+					names[i] = name + "*"
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Name, info.Server, strings.Join(names, ","), firstLine(info.Tool.Description))
+		}
+		return tw.Flush()
+	},
+}
+
+var mcpListPromptsCmd = &cobra.Command{
+	Use:   "list-prompts",
+	Short: "list the prompts of the mcp servers",
+	Long: `List the prompts of the mcp servers selected by '-M', a prompt is used by its name as an argument,
+e.g. 'gpt -M github <prompt> <question>' replaces the argument by the prompt.
+The arguments marked with '*' are required.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		servers, err := startMCPs(cmd)
+		if err != nil {
+			return err
+		}
+		defer servers.Shutdown()
+
+		infos, err := servers.Prompts(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			return printJSON(infos)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSERVER\tARGUMENTS\tDESCRIPTION")
+		for _, info := range infos {
+			names := make([]string, 0, len(info.Prompt.Arguments))
+			for _, arg := range info.Prompt.Arguments {
+				if arg.Required {
+					names = append(names, arg.Name+"*")
+				} else {
+					names = append(names, arg.Name)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Prompt.Name, info.Server, strings.Join(names, ","), firstLine(info.Prompt.Description))
+		}
+		return tw.Flush()
+	},
+}
+
+var mcpListResourcesCmd = &cobra.Command{
+	Use:   "list-resources",
+	Short: "list the resources and resource templates of the mcp servers",
+	Long:  `List the resources and resource templates of the mcp servers selected by '-M', a resource is read by '@mcp:<uri>' in a user prompt.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		servers, err := startMCPs(cmd)
+		if err != nil {
+			return err
+		}
+		defer servers.Shutdown()
+
+		resources, templates := servers.Resources()
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			return printJSON(map[string]any{"resources": resources, "templates": templates})
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "URI\tNAME\tMIME TYPE\tDESCRIPTION")
+		for _, resource := range resources {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", resource.URI, resource.Name, resource.MIMEType, firstLine(resource.Description))
+		}
+		for _, template := range templates {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", template.URITemplate.Raw(), template.Name, template.MIMEType, firstLine(template.Description))
+		}
+		return tw.Flush()
+	},
+}
+
+var mcpCallCmd = &cobra.Command{
+	Use:   "call <tool>",
+	Short: "call a tool of the mcp servers",
+	Long: `Call a tool of the mcp servers selected by '-M' with the JSON arguments of '--args', and print its result.
+The tool is named as listed by 'gpt mcp list-tools'. The text of the result is printed, '--json' prints the whole result.
+It fails when the tool responds an error.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		arguments := make(map[string]any)
+		if raw, _ := cmd.Flags().GetString("args"); strings.TrimSpace(raw) != "" {
+			if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+				return fmt.Errorf("invalid JSON arguments: %w", err)
+			}
+		}
+		servers, err := startMCPs(cmd)
+		if err != nil {
+			return err
+		}
+		defer servers.Shutdown()
+
+		result, err := servers.CallToolResult(cmd.Context(), args[0], arguments)
+		if err != nil {
+			return err
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else {
+			for _, content := range result.Content {
+				switch content := content.(type) {
+				case mcp.TextContent:
+					fmt.Println(content.Text)
+				case mcp.ImageContent:
+					fmt.Printf("[image %s, %d bytes]\n", content.MIMEType, base64.StdEncoding.DecodedLen(len(content.Data)))
+				case mcp.AudioContent:
+					fmt.Printf("[audio %s, %d bytes]\n", content.MIMEType, base64.StdEncoding.DecodedLen(len(content.Data)))
+				case mcp.EmbeddedResource:
+					if text, ok := content.Resource.(mcp.TextResourceContents); ok {
+						fmt.Println(text.Text)
+					} else {
+						fmt.Printf("[resource %s]\n", content.Resource)
+					}
+				default:
+					fmt.Printf("[%T]\n", content)
+				}
+			}
+		}
+		if result.IsError {
+			return fmt.Errorf("tool %s responds an error", args[0])
+		}
+		return nil
+	},
+}
+
+// startMCPs starts the mcp servers of the '-M' flags of an inspection command.
+// The tools are not read from the cache, so the servers are always started and what they offer now is listed.
+func startMCPs(cmd *cobra.Command) (*mcps.MCPs, error) {
+	appConf, err := loadAppConf()
+	if err != nil {
+		return nil, err
+	}
+	providers, _ := cmd.Flags().GetStringArray("mcp")
+	if len(providers) == 0 {
+		return nil, errors.New("no mcp server selected, use -M to select one")
+	}
+	mcps.CacheDir = ""
+	mcps.Elicitation = tools.NewElicitor(terminal, os.Stderr)
+	return mcps.New(cmd.Context(), appConf.MCPServers, providers...)
+}
+
+// firstLine returns the first line of a description, so a table row is kept in one line.
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// printJSON prints a value as indented JSON.
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// runTool runs a tool like 'gpt -t name user', its output is returned instead of handled by its action.
+// The user input is used as is, files and mcp prompts are not expanded as it comes from another agent.
+func runTool(ctx context.Context, name string, tool tools.Tool, user string, variables map[string]string) (string, error) {
+	appConf, err := loadAppConf()
+	if err != nil {
+		return "", err
+	}
+	appConf.LLM.Gateway = utils.Or(tool.URL, appConf.LLM.Gateway)
+	appConf.LLM.ApiKey = utils.Or(tool.Key, appConf.LLM.ApiKey)
+	appConf.LLM.Model = utils.Or(tool.Model, appConf.LLM.Model)
+	appConf.LLM.ReasonEffort = utils.Or(tool.ReasonEffort, appConf.LLM.ReasonEffort)
+
+	var outputSchema *schema.Schema
+	if tool.Schema != "" {
+		outputSchema, err = schema.Load(tool.Schema, utils.ConfigPath("tools"), utils.ConfigPath())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	servers, providers := tool.Servers(appConf.MCPServers, nil)
+	mcpServers, err := mcps.New(ctx, servers, providers...)
+	if err != nil {
+		return "", err
+	}
+	defer mcpServers.Shutdown()
+	if err := mcpServers.SetToolFilter(tool.AllowTools, tool.DenyTools); err != nil {
+		return "", err
+	}
+
+	temperature := 1.0
+	if tool.Temperature != nil {
+		temperature = *tool.Temperature
+	}
+	appConf.Prompt = &utils.Prompt{
+		System:        utils.UserPrompt(variables, tool.SystemPrompt),
+		User:          utils.ExpandVariables(tool.UserPrompt(user), variables),
+		JsonMode:      outputSchema != nil,
+		OverrideModel: tool.Model,
+		Temperature:   temperature,
+		MCPServers:    mcpServers,
+		Schema:        outputSchema,
+		Tool:          name,
+	}
+	appConf.PickupModel()
+
+	var buf bytes.Buffer
+	if err := llm.Chat(ctx, appConf, &buf); err != nil {
+		return "", err
+	}
+	output := buf.Bytes()
+	if appConf.Prompt.JsonMode {
+		output = llm.ExtractCodeBlock(output)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func init() {
+	mcpServeCmd.Flags().String("http", "", "serve streamable HTTP on this address, e.g. :8080, instead of stdio")
+	for _, c := range []*cobra.Command{mcpListToolsCmd, mcpListPromptsCmd, mcpListResourcesCmd, mcpCallCmd} {
+		c.Flags().StringArrayP("mcp", "M", []string{}, "model context provider to inspect, can be a name of 'mcpServers', a mcp.json file, a file path(stdio) or a url(sse)")
+		c.Flags().Bool("json", false, "print JSON instead of a table")
+	}
+	mcpCallCmd.Flags().String("args", "", "the JSON arguments of the tool, e.g. '{\"ip\": \"8.8.8.8\"}'")
+	mcpCmd.AddCommand(mcpServeCmd, mcpListToolsCmd, mcpListPromptsCmd, mcpListResourcesCmd, mcpCallCmd)
+	rootCmd.AddCommand(mcpCmd)
+}
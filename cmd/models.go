@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/elsejj/gpt/internal/llm"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// modelsCmd lists the configured models and the models available from the provider.
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "list configured models and models available from the provider",
+	Long: `List the models configured in 'llms' of the config file, and the models available from the provider.
+For the ollama provider, the locally pulled models are listed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appConf, err := loadAppConf()
+		if err != nil {
+			return err
+		}
+		model, _ := cmd.Flags().GetString("model")
+		appConf.Prompt = &utils.Prompt{OverrideModel: model}
+		appConf.PickupModel()
+
+		aliases := make([]string, 0, len(appConf.LLMs))
+		for alias := range appConf.LLMs {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ALIAS\tMODEL\tPROVIDER")
+		for _, alias := range aliases {
+			conf := appConf.LLMs[alias]
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", alias, conf.Model, conf.Provider)
+		}
+		tw.Flush()
+
+		lister, ok := llm.NewProvider(&appConf.LLM).(llm.ModelLister)
+		if !ok {
+			return nil
+		}
+		models, err := lister.Models(context.Background())
+		if err != nil {
+			return fmt.Errorf("list models of %s: %w", appConf.LLM.Provider, err)
+		}
+		sort.Strings(models)
+		fmt.Printf("\navailable models of %s (%s):\n", appConf.LLM.Provider, appConf.LLM.Gateway)
+		for _, m := range models {
+			fmt.Println(m)
+		}
+		return nil
+	},
+}
+
+func init() {
+	modelsCmd.Flags().StringP("model", "m", "", "list the models of the provider of this model, with format 'model[:provider]'")
+	rootCmd.AddCommand(modelsCmd)
+}
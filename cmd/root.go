@@ -4,16 +4,25 @@ Copyright © 2025 elsejj
 package cmd
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 
 	"github.com/elsejj/gpt/internal/llm"
 	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/repl"
+	"github.com/elsejj/gpt/internal/schema"
+	"github.com/elsejj/gpt/internal/session"
 	"github.com/elsejj/gpt/internal/tools"
 	"github.com/elsejj/gpt/internal/utils"
 	"github.com/spf13/cobra"
@@ -22,6 +31,51 @@ import (
 
 var cfgFile string
 
+// terminal reads the answers of the user, it's shared by the interactive chat, the tool approval and the confirmation of the tool action,
+// so neither of them buffers the input of the other. It reads the controlling terminal when stdin is consumed by the prompt.
+var terminal = bufio.NewReader(os.Stdin)
+
+// errNoTerminal is the error of a question to the user when stdin is consumed by the prompt and there is no terminal.
+var errNoTerminal = errors.New("cannot ask the user: stdin is used by the prompt and there is no terminal, pass the prompt as arguments instead")
+
+// noTerminal fails to read the answers of the user.
+type noTerminal struct{}
+
+func (noTerminal) Read([]byte) (int, error) {
+	return 0, errNoTerminal
+}
+
+// answersAfterStdin returns the reader of the answers of the user once stdin is consumed by the prompt.
+func answersAfterStdin() *bufio.Reader {
+	tty, err := utils.OpenTerminal()
+	if err != nil {
+		slog.Debug("no terminal to read the answers", "error", err)
+		return bufio.NewReader(noTerminal{})
+	}
+	return bufio.NewReader(tty)
+}
+
+// readStdin reads the piped stdin for the prompt. Nothing is read when stdin is a terminal, in interactive chat,
+// or with --no-stdin, which is needed when the parent never closes stdin, e.g. some CI runners.
+func readStdin(in io.Reader, piped bool) (string, error) {
+	if !piped || viper.GetBool("interactive") || viper.GetBool("no-stdin") {
+		return "", nil
+	}
+	return utils.ReadInput(in, viper.GetInt64("stdin-limit"))
+}
+
+// userPrompt builds the user prompt of the arguments, the piped stdin is added as a fenced block.
+// A `-` argument is where stdin is placed, like `@-`.
+func userPrompt(tool *tools.Tool, variables map[string]string, args []string, stdin string) string {
+	args = slices.Clone(args)
+	for i, arg := range args {
+		if arg == "-" {
+			args[i] = "@-"
+		}
+	}
+	return utils.WithStdin(tool.UserPrompt(utils.UserPrompt(variables, args...)), stdin)
+}
+
 //go:embed version.txt
 var appVersion string
 
@@ -35,30 +89,17 @@ It send prompt from user input, file to gpt compatible api and get response back
 
 Version: v` + appVersion,
 	Version: "v" + appVersion,
+	Args:    cobra.ArbitraryArgs,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
 
 		args, variables := utils.SplitContentAndVariables(args)
 
-		verbose := viper.GetInt("verbose")
-		if verbose >= 2 {
-			slog.SetLogLoggerLevel(slog.LevelDebug)
-		} else if verbose >= 1 {
-			slog.SetLogLoggerLevel(slog.LevelInfo)
-		} else {
-			slog.SetLogLoggerLevel(slog.LevelWarn)
-		}
-
-		if len(cfgFile) == 0 {
-			cfgFile = utils.ConfigPath("config.yaml")
-		}
-		err := utils.InitConfig(cfgFile)
-		if err != nil {
-			os.Exit(1)
-		}
+		setLogLevel(viper.GetInt("verbose"))
 
 		var tool tools.Tool
+		var err error
 		toolName := viper.GetString("tool")
 		if toolName != "" {
 			tool, err = tools.Load(toolName)
@@ -68,7 +109,7 @@ Version: v` + appVersion,
 			}
 		}
 
-		appConf, err := utils.LoadConfig(cfgFile)
+		appConf, err := loadAppConf()
 		if err != nil {
 			os.Exit(1)
 		}
@@ -77,7 +118,17 @@ Version: v` + appVersion,
 		appConf.LLM.Model = utils.Or(tool.Model, viper.GetString("model"), appConf.LLM.Model)
 		appConf.LLM.ReasonEffort = utils.Or(tool.ReasonEffort, viper.GetString("reason"), appConf.LLM.ReasonEffort)
 
-		if viper.GetBool("version") || len(args) == 0 {
+		interactive := viper.GetBool("interactive")
+		stdin, err := readStdin(os.Stdin, utils.HasStdin())
+		if err != nil {
+			slog.Error("Error reading stdin", "err", err)
+			os.Exit(1)
+		}
+		if stdin != "" {
+			terminal = answersAfterStdin()
+		}
+
+		if viper.GetBool("version") || (len(args) == 0 && !interactive && stdin == "") {
 			fmt.Println("Version:      ", appVersion)
 			fmt.Println("ConfigFile:   ", cfgFile)
 			fmt.Println("Gateway:      ", appConf.LLM.Gateway)
@@ -87,57 +138,103 @@ Version: v` + appVersion,
 			os.Exit(0)
 		}
 
-		MCPs := utils.Or(tool.MCPs, viper.GetStringSlice("mcp"))
-
-		mcpServers, err := mcps.New(MCPs...)
+		sess, err := openSession()
 		if err != nil {
-			slog.Error("Error creating mcp client", "err", err)
+			slog.Error("Error opening session", "err", err)
 			os.Exit(1)
 		}
-		defer mcpServers.Shutdown()
 
-		appConf.Prompt = &utils.Prompt{
-			System:        utils.UserPrompt(variables, utils.Or(tool.SystemPrompt, strings.Join(viper.GetStringSlice("system"), " "))),
-			Images:        viper.GetStringSlice("images"),
-			User:          tool.UserPrompt(utils.UserPrompt(variables, args...)),
-			WithUsage:     viper.GetBool("usage"),
-			JsonMode:      viper.GetBool("json"),
-			OverrideModel: utils.Or(tool.Model, viper.GetString("model")),
-			OnlyCodeBlock: viper.GetBool("code"),
-			Temperature:   viper.GetFloat64("temperature"),
-			MCPServers:    mcpServers,
+		var outputSchema *schema.Schema
+		if source := utils.Or(tool.Schema, viper.GetString("schema")); source != "" {
+			outputSchema, err = schema.Load(source, utils.ConfigPath("tools"), utils.ConfigPath())
+			if err != nil {
+				slog.Error("Error loading schema", "err", err)
+				os.Exit(1)
+			}
 		}
 
-		appConf.PickupModel()
-		var w io.Writer
-		var buf *bytes.Buffer
-		if appConf.Prompt.OnlyCodeBlock || appConf.Prompt.JsonMode || strings.TrimSpace(tool.Action) != "" {
-			buf = bytes.NewBuffer(nil)
-			w = buf
-		} else {
-			w = os.Stdout
-		}
-		err = llm.Chat(appConf, w)
+		// Ctrl-C in interactive mode stops the current answer only, it's handled by the repl
+		signals := []os.Signal{os.Interrupt, syscall.SIGTERM}
+		if interactive {
+			signals = signals[1:]
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), signals...)
+		defer stop()
+
+		servers, MCPs := tool.Servers(appConf.MCPServers, viper.GetStringSlice("mcp"))
+		appConf.MCPServers = servers
+
+		// the servers started can ask the model by sampling, the model is read when they ask
+		sampler := llm.NewSampler(appConf)
+		sampler.MaxTokens = viper.GetInt64("max-sampling-tokens")
+		if viper.GetBool("approve-sampling") {
+			sampler.Approve = func(server string, request string) (bool, error) {
+				return tools.Ask(terminal, os.Stderr, fmt.Sprintf("mcp server %q asks the model:\n%s\nallow?, [y/N]: ", server, request))
+			}
+		}
+		mcps.Sampling = sampler
+		mcps.Elicitation = tools.NewElicitor(terminal, os.Stderr)
+
+		// Ctrl-C always aborts starting the mcp servers
+		mcps.StartTimeout = viper.GetDuration("mcp-timeout")
+		startCtx, stopStart := signal.NotifyContext(ctx, os.Interrupt)
+		mcpServers, err := mcps.New(startCtx, servers, MCPs...)
 		if err != nil {
-			slog.Error("Error sending prompt", "err", err)
+			slog.Error("Error creating mcp client", "err", err)
+			os.Exit(exitCode(startCtx))
+		}
+		stopStart()
+		// the tool filters of the flags extend the ones of the tool, allow lists are not merged
+		allowTools := utils.Or(viper.GetStringSlice("allow-tool"), tool.AllowTools)
+		denyTools := append(slices.Clone(tool.DenyTools), viper.GetStringSlice("deny-tool")...)
+		if err := mcpServers.SetToolFilter(allowTools, denyTools); err != nil {
+			slog.Error("Error filtering mcp tools", "err", err)
+			mcpServers.Shutdown()
+			os.Exit(1)
+		}
+		approval, err := tools.NewApproval(utils.Or(viper.GetStringSlice("approve-tool"), tool.ApproveTools), terminal, os.Stderr)
+		if err != nil {
+			slog.Error("Error creating tool approval", "err", err)
+			mcpServers.Shutdown()
 			os.Exit(1)
 		}
 
-		if buf != nil {
-			result := buf.Bytes()
-			if appConf.Prompt.OnlyCodeBlock || appConf.Prompt.JsonMode {
-				result = llm.ExtractCodeBlock(result)
+		appConf.Prompt = &utils.Prompt{
+			System:          utils.UserPrompt(variables, utils.Or(tool.SystemPrompt, strings.Join(viper.GetStringSlice("system"), " "))),
+			Images:          viper.GetStringSlice("images"),
+			User:            userPrompt(&tool, variables, args, stdin),
+			WithUsage:       viper.GetBool("usage"),
+			JsonMode:        viper.GetBool("json") || outputSchema != nil,
+			OverrideModel:   utils.Or(tool.Model, viper.GetString("model")),
+			OnlyCodeBlock:   viper.GetBool("code"),
+			Temperature:     viper.GetFloat64("temperature"),
+			MCPServers:      mcpServers,
+			Schema:          outputSchema,
+			MaxCost:         viper.GetFloat64("max-cost"),
+			MaxTokens:       viper.GetInt64("max-tokens"),
+			Tool:            toolName,
+			Timeout:         viper.GetDuration("timeout"),
+			ToolTimeout:     viper.GetDuration("tool-timeout"),
+			ToolConcurrency: viper.GetInt("tool-concurrency"),
+			MaxToolRounds:   viper.GetInt("max-tool-rounds"),
+			MaxToolFailures: viper.GetInt("max-tool-failures"),
+		}
+		if approval != nil {
+			appConf.Prompt.ApproveTool = func(name, arguments string) (string, bool, error) {
+				return approval.Confirm(arguments, name, mcpServers.QualifiedToolName(name))
 			}
+		}
+		if sess != nil {
+			appConf.Prompt.History = sess.Messages
+		}
 
-			if strings.TrimSpace(tool.Action) != "" {
-				confirmed := viper.GetBool("confirmed")
-				if err := tool.DoAction(result, variables, confirmed); err != nil {
-					slog.Error("Error executing tool action", "err", err)
-					os.Exit(1)
-				}
-			} else if appConf.Prompt.OnlyCodeBlock || appConf.Prompt.JsonMode {
-				os.Stdout.Write(result)
-			}
+		appConf.PickupModel()
+
+		// the mcp servers must be shut down before exit, so errors are returned instead of exiting here
+		err = run(ctx, appConf, &tool, sess, variables, interactive, len(args) > 0)
+		mcpServers.Shutdown()
+		if err != nil {
+			os.Exit(exitCode(ctx))
 		}
 	},
 }
@@ -174,15 +271,124 @@ func init() {
 	rootCmd.Flags().StringP("model", "m", "", "Model override default model, with format 'model[:provider]'")
 	rootCmd.Flags().StringP("reason", "r", "", "Reasoning effort to used, can be one of [1, minimal, 2, low, 3, medium, 4, high, 0, none]")
 	rootCmd.Flags().BoolP("code", "c", false, "extract first code block if exists, useful for pipe code generation to next command")
-	rootCmd.Flags().StringArrayP("mcp", "M", []string{}, "model context provider to be used, can be a file path(stdio) or a url(sse)")
+	rootCmd.Flags().StringArrayP("mcp", "M", []string{}, "model context provider to be used, can be a name of 'mcpServers', a mcp.json file, a file path(stdio) or a url(sse)")
+	rootCmd.Flags().Duration("mcp-timeout", mcps.StartTimeout, "skip a mcp server which does not start in this duration, 0 means no limit")
+	rootCmd.Flags().StringArray("allow-tool", []string{}, "only offer the mcp tools matching this glob, e.g. 'github__*', can be repeated")
+	rootCmd.Flags().StringArray("deny-tool", []string{}, "do not offer the mcp tools matching this glob, can be repeated")
+	rootCmd.Flags().Int("tool-concurrency", llm.DefaultToolConcurrency, "max count of mcp tools called at the same time")
+	rootCmd.Flags().Int("max-tool-rounds", llm.DefaultMaxToolRounds, "disable the tools after this count of rounds of tool calls, so the model gives a final answer, 0 means no limit")
+	rootCmd.Flags().Int("max-tool-failures", llm.DefaultMaxToolFailures, "abort when a mcp tool fails this count of times in a row, 0 means no limit")
+	rootCmd.Flags().Bool("approve-sampling", false, "ask before a mcp server asks the model by sampling")
+	rootCmd.Flags().Int64("max-sampling-tokens", 20000, "max total tokens used by the sampling requests of the mcp servers, 0 means no limit")
+	rootCmd.Flags().StringArray("approve-tool", []string{}, "ask before calling the mcp tools matching this glob, 'always' or 'never', can be repeated")
 	rootCmd.Flags().StringP("tool", "t", "", "use a tool for this request")
 	rootCmd.Flags().String("url", "", "override api URL")
 	rootCmd.Flags().String("key", "", "override api key")
 	rootCmd.Flags().BoolP("confirmed", "y", false, "confirm before executing non-output actions")
+	rootCmd.Flags().StringP("session", "S", "", "keep the conversation in a named session, resume it if exists")
+	rootCmd.Flags().BoolP("continue", "C", false, "continue the most recently used session")
+	rootCmd.Flags().BoolP("interactive", "I", false, "chat interactively on the terminal, type /help for commands")
+	rootCmd.Flags().String("schema", "", "JSON schema file (or inline JSON) the output must match, implies --json")
+	rootCmd.Flags().Int64("stdin-limit", utils.DefaultStdinLimit, "max bytes read from piped stdin")
+	rootCmd.Flags().Bool("no-stdin", false, "do not read piped stdin, e.g. when the parent never closes it")
+	rootCmd.Flags().Float64("max-cost", 0, "abort when the cost exceeds this amount in USD, it needs the pricing of the model")
+	rootCmd.Flags().Int64("max-tokens", 0, "abort when the total tokens exceed this count")
+	rootCmd.Flags().Duration("timeout", 0, "abort the request after this duration, e.g. 2m, 0 means no limit")
+	rootCmd.Flags().Duration("tool-timeout", 0, "abort a mcp tool call after this duration, e.g. 30s, 0 means no limit")
 
 	viper.BindPFlags(rootCmd.Flags())
 }
 
+// run chats with the model, or starts the interactive chat, and then handles the output.
+// The errors are logged before returned.
+func run(ctx context.Context, appConf *utils.AppConf, tool *tools.Tool, sess *session.Session, variables map[string]string, interactive bool, hasArgs bool) error {
+	if interactive {
+		first := ""
+		if hasArgs {
+			first = appConf.Prompt.User
+		}
+		if err := repl.New(appConf, sess, terminal, os.Stdout).Run(ctx, first); err != nil {
+			slog.Error("Error in interactive chat", "err", err)
+			return err
+		}
+		return nil
+	}
+
+	var w io.Writer
+	var buf *bytes.Buffer
+	if appConf.Prompt.OnlyCodeBlock || appConf.Prompt.JsonMode || strings.TrimSpace(tool.Action) != "" {
+		buf = bytes.NewBuffer(nil)
+		w = buf
+	} else {
+		w = os.Stdout
+	}
+	err := llm.Chat(ctx, appConf, w)
+	if err != nil {
+		slog.Error("Error sending prompt", "err", err)
+		return err
+	}
+
+	if sess != nil {
+		sess.Messages = appConf.Prompt.History
+		sess.Model = appConf.LLM.Model
+		if err := sess.Save(); err != nil {
+			slog.Error("Error saving session", "err", err)
+		}
+	}
+
+	if buf != nil {
+		result := buf.Bytes()
+		if appConf.Prompt.OnlyCodeBlock || appConf.Prompt.JsonMode {
+			result = llm.ExtractCodeBlock(result)
+		}
+
+		if strings.TrimSpace(tool.Action) != "" {
+			confirmed := viper.GetBool("confirmed")
+			if err := tool.DoAction(result, variables, confirmed, terminal); err != nil {
+				slog.Error("Error executing tool action", "err", err)
+				return err
+			}
+		} else if appConf.Prompt.OnlyCodeBlock || appConf.Prompt.JsonMode {
+			os.Stdout.Write(result)
+		}
+	}
+	return nil
+}
+
+// exitCode returns the exit code of a failed run, 130 like a shell when it's interrupted.
+func exitCode(ctx context.Context) int {
+	if ctx.Err() != nil {
+		return 130
+	}
+	return 1
+}
+
+// setLogLevel sets the level of slog by the verbose level.
+func setLogLevel(verbose int) {
+	if verbose >= 2 {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	} else if verbose >= 1 {
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+	} else {
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+	}
+}
+
+// loadAppConf loads the application config file, it's created with default settings if not exists.
+// The OAuth tokens of the mcp servers are stored in the oauth folder of the config directory,
+// the tools of the stdio servers are cached in its cache/mcp folder.
+func loadAppConf() (*utils.AppConf, error) {
+	if len(cfgFile) == 0 {
+		cfgFile = utils.ConfigPath("config.yaml")
+	}
+	if err := utils.InitConfig(cfgFile); err != nil {
+		return nil, err
+	}
+	mcps.TokenDir = utils.ConfigPath("oauth")
+	mcps.CacheDir = utils.ConfigPath("cache", "mcp")
+	return utils.LoadConfig(cfgFile)
+}
+
 // initConfig reads in config file and ENV variables if set.
 // It also sets up the viper configuration.
 func initConfig() {
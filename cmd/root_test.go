@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/tools"
+	"github.com/spf13/viper"
+)
+
+func TestArgsWithPipedStdin(t *testing.T) {
+	stdin, err := readStdin(strings.NewReader("diff --git a b\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := userPrompt(&tools.Tool{}, nil, []string{"review", "this"}, stdin)
+	if want := "review this\n\n```\ndiff --git a b\n```"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// a `-` argument places stdin
+	got = strings.TrimSpace(userPrompt(&tools.Tool{}, nil, []string{"review", "-", "briefly"}, stdin))
+	if want := "review ```\ndiff --git a b\n``` briefly"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestStdinNotRead(t *testing.T) {
+	if stdin, err := readStdin(strings.NewReader("input"), false); stdin != "" || err != nil {
+		t.Fatalf("expected a terminal not read, got %q %v", stdin, err)
+	}
+
+	viper.Set("no-stdin", true)
+	defer viper.Set("no-stdin", false)
+	if stdin, err := readStdin(strings.NewReader("input"), true); stdin != "" || err != nil {
+		t.Fatalf("expected stdin not read with --no-stdin, got %q %v", stdin, err)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/elsejj/gpt/internal/gateway"
+	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd serves the configured models as an OpenAI compatible endpoint.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve the models as an OpenAI compatible api",
+	Long: `Serve /v1/chat/completions and /v1/models, so editors and scripts can use one local endpoint
+without their own api keys. The model of a request can be an alias of 'llms' or 'model[:provider]',
+the default model is used when it's empty.
+The tools of the '--mcp' servers are offered to the model and executed by the server,
+unless the request has tools of its own, whose calls are returned to the client.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetInt("verbose")
+		setLogLevel(verbose)
+		addr, _ := cmd.Flags().GetString("addr")
+		clientKey, _ := cmd.Flags().GetString("client-key")
+		mcpProviders, _ := cmd.Flags().GetStringArray("mcp")
+
+		appConf, err := loadAppConf()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		mcpServers, err := mcps.New(ctx, appConf.MCPServers, mcpProviders...)
+		if err != nil {
+			return err
+		}
+		defer mcpServers.Shutdown()
+		allowTools, _ := cmd.Flags().GetStringArray("allow-tool")
+		denyTools, _ := cmd.Flags().GetStringArray("deny-tool")
+		if err := mcpServers.SetToolFilter(allowTools, denyTools); err != nil {
+			return err
+		}
+
+		httpServer := gateway.New(appConf, mcpServers, clientKey).HTTPServer(addr)
+		errs := make(chan error, 1)
+		go func() {
+			slog.Warn("serving openai api", "url", "http://"+addr+"/v1", "model", appConf.LLM.Model, "tools", len(mcpServers.Tools))
+			errs <- httpServer.ListenAndServe()
+		}()
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("addr", "127.0.0.1:8080", "the address to listen on")
+	serveCmd.Flags().String("client-key", "", "the key the clients must send as a bearer token, not checked when empty")
+	serveCmd.Flags().StringArrayP("mcp", "M", []string{}, "model context provider whose tools are executed by the server, can be a name of 'mcpServers', a mcp.json file, a file path(stdio) or a url(sse)")
+	serveCmd.Flags().StringArray("allow-tool", []string{}, "only offer the mcp tools matching this glob, can be repeated")
+	serveCmd.Flags().StringArray("deny-tool", []string{}, "do not offer the mcp tools matching this glob, can be repeated")
+	serveCmd.Flags().IntP("verbose", "v", 1, "Verbose level, 0-3, the requests are logged at 1")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/elsejj/gpt/internal/session"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// sessionCmd groups the subcommands to manage saved conversations.
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "manage saved conversation sessions",
+	Long: `A session keeps the whole conversation of a name, use '--session name' to start or resume it,
+or '--continue' to resume the most recently used one.`,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list saved sessions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessions, err := session.List()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tMESSAGES\tMODEL\tUPDATED")
+		for _, s := range sessions {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", s.Name, len(s.Messages), s.Model, s.UpdatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return tw.Flush()
+	},
+}
+
+var sessionShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "show the conversation of a session",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := session.Load(args[0])
+		if err != nil {
+			return err
+		}
+		return s.WriteTranscript(os.Stdout)
+	},
+}
+
+var sessionForkCmd = &cobra.Command{
+	Use:   "fork <src> <dst>",
+	Short: "copy a session to a new one",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := session.Fork(args[0], args[1])
+		return err
+	},
+}
+
+var sessionDeleteCmd = &cobra.Command{
+	Use:   "delete <name>...",
+	Short: "delete sessions",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, name := range args {
+			if err := session.Delete(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// openSession opens the session selected by '--session' or '--continue', it returns nil if none is selected.
+func openSession() (*session.Session, error) {
+	if name := viper.GetString("session"); name != "" {
+		return session.Open(name)
+	}
+	if viper.GetBool("continue") {
+		return session.Last()
+	}
+	return nil, nil
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionListCmd, sessionShowCmd, sessionForkCmd, sessionDeleteCmd)
+	rootCmd.AddCommand(sessionCmd)
+}
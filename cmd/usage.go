@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elsejj/gpt/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+// usageCmd reports the spend recorded in the usage ledger.
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "report the token usage and cost of the chats",
+	Long: `Report the token usage and cost recorded in the usage ledger, grouped by day, model or tool.
+The cost is computed from the 'pricing' of the models, it's zero for a model without pricing.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		by, _ := cmd.Flags().GetString("by")
+		days, _ := cmd.Flags().GetInt("days")
+
+		var since time.Time
+		if days > 0 {
+			y, m, d := time.Now().Date()
+			since = time.Date(y, m, d-days+1, 0, 0, 0, 0, time.Local)
+		}
+		entries, err := usage.Read(since)
+		if err != nil {
+			return err
+		}
+		rows, err := usage.Summarize(entries, usage.GroupBy(by))
+		if err != nil {
+			return err
+		}
+
+		var total usage.Row
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tCHATS\tPROMPT\tCOMPLETION\tCOST\n", strings.ToUpper(by))
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.4f\n", row.Key, row.Chats, row.PromptTokens, row.CompletionTokens, row.Cost)
+			total.Chats += row.Chats
+			total.PromptTokens += row.PromptTokens
+			total.CompletionTokens += row.CompletionTokens
+			total.Cost += row.Cost
+		}
+		fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%d\t%.4f\n", total.Chats, total.PromptTokens, total.CompletionTokens, total.Cost)
+		return tw.Flush()
+	},
+}
+
+func init() {
+	usageCmd.Flags().String("by", "day", "group the usage by day, model or tool")
+	usageCmd.Flags().Int("days", 30, "report the last days, 0 reports all")
+	rootCmd.AddCommand(usageCmd)
+}
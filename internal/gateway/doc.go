@@ -0,0 +1,2 @@
+// Package gateway serves an OpenAI compatible chat completion endpoint, the requests are routed to the configured models.
+package gateway
@@ -0,0 +1,360 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elsejj/gpt/internal/llm"
+	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+const (
+	// readTimeout limits reading a request, idleTimeout closes the keep-alive connections which are not used.
+	readTimeout = time.Minute
+	idleTimeout = 2 * time.Minute
+	// writeTimeout limits the answer of a request, it allows a long answer with tool calls to be streamed.
+	// The chat of a request is aborted at the same time.
+	writeTimeout = 10 * time.Minute
+)
+
+// Server answers the chat completion requests of the clients with the models of the config.
+// The model of a request is resolved like '-m', it can be an alias of 'llms' or 'model[:provider]',
+// so the api keys stay in the config of the server.
+type Server struct {
+	conf *utils.AppConf
+	// servers are the MCP servers whose tools are offered to the model, it can be nil.
+	servers *mcps.MCPs
+	// apiKey is the key the clients must send as a bearer token, it's not checked when empty.
+	apiKey string
+}
+
+// New creates a gateway server of conf, the tools of servers are executed on the server side.
+func New(conf *utils.AppConf, servers *mcps.MCPs, apiKey string) *Server {
+	return &Server{conf: conf, servers: servers, apiKey: apiKey}
+}
+
+// HTTPServer returns the http server of the handler listening on addr, the slow and idle clients are disconnected.
+func (s *Server) HTTPServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// Handler returns the http handler of the OpenAI endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	mux.HandleFunc("GET /v1/models", s.models)
+	return s.authorize(mux)
+}
+
+// authorize rejects the requests without the api key of the server.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.apiKey != "" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.apiKey)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid api key")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// models lists the default model and the aliases of 'llms'.
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	data := []model{{ID: s.conf.LLM.Model, Object: "model", OwnedBy: s.conf.LLM.Provider}}
+	aliases := make([]string, 0, len(s.conf.LLMs))
+	for alias := range s.conf.LLMs {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		data = append(data, model{ID: alias, Object: "model", OwnedBy: utils.Or(s.conf.LLMs[alias].Provider, s.conf.LLM.Provider)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+// requestConf returns the config of a request to the model, the config of the server is not changed.
+func (s *Server) requestConf(model string) *utils.AppConf {
+	conf := &utils.AppConf{LLM: s.conf.LLM, LLMs: s.conf.LLMs}
+	conf.Prompt = &utils.Prompt{MCPServers: s.servers, Tool: "serve", Timeout: writeTimeout}
+	if model != s.conf.LLM.Model {
+		// the default model is kept as is, otherwise its provider would be reset
+		conf.Prompt.OverrideModel = model
+	}
+	conf.PickupModel()
+	return conf
+}
+
+// chatCompletions answers a chat completion request, the answer is streamed as server sent events when asked.
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	var req openai.ChatCompletionNewParams
+	// stream is not a field of the params, the sdk sets it by the method
+	var opts struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request: "+err.Error())
+		return
+	}
+	json.Unmarshal(body, &opts)
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages is required")
+		return
+	}
+	includeUsage := req.StreamOptions.IncludeUsage.Value
+
+	conf := s.requestConf(req.Model)
+	c := completion{
+		ID:      newID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   conf.LLM.Model,
+	}
+	slog.Info("chat completion", "id", c.ID, "model", req.Model, "provider", conf.LLM.Provider, "upstream", conf.LLM.Model, "stream", opts.Stream)
+
+	if !opts.Stream {
+		var buf bytes.Buffer
+		round, err := llm.Complete(r.Context(), conf, req, &buf)
+		if err != nil {
+			writeChatError(w, err)
+			return
+		}
+		content := round.Content
+		if content == "" {
+			content = buf.String()
+		}
+		msg := &message{Role: "assistant", ToolCalls: toolCalls(round.ToolCalls, false)}
+		if content != "" || len(msg.ToolCalls) == 0 {
+			msg.Content = &content
+		}
+		c.Choices = []choice{{Message: msg, FinishReason: finishReason(round)}}
+		c.Usage = newUsage(round.Usage)
+		writeJSON(w, http.StatusOK, c)
+		return
+	}
+
+	c.Object = "chat.completion.chunk"
+	sw := &chunkWriter{w: w, c: c}
+	round, err := llm.Complete(r.Context(), conf, req, sw)
+	if err != nil {
+		if !sw.started {
+			writeChatError(w, err)
+			return
+		}
+		// the status is sent, the error is the last event
+		sw.event(errorBody(errorType(err), err.Error()))
+		return
+	}
+	if calls := toolCalls(round.ToolCalls, true); len(calls) > 0 {
+		sw.send(&message{ToolCalls: calls}, nil)
+	}
+	sw.send(&message{}, finishReason(round))
+	if includeUsage {
+		sw.c.Choices = []choice{}
+		sw.c.Usage = newUsage(round.Usage)
+		sw.event(sw.c)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	sw.flush()
+}
+
+// completion is a chat completion or a chunk of it.
+type completion struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []choice `json:"choices"`
+	Usage   *usage   `json:"usage,omitempty"`
+}
+
+type choice struct {
+	Index        int      `json:"index"`
+	Message      *message `json:"message,omitempty"`
+	Delta        *message `json:"delta,omitempty"`
+	FinishReason *string  `json:"finish_reason"`
+}
+
+type message struct {
+	Role      string     `json:"role,omitempty"`
+	Content   *string    `json:"content,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+}
+
+type toolCall struct {
+	// Index is only sent in the chunks.
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+func newUsage(u openai.CompletionUsage) *usage {
+	return &usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// toolCalls converts the tool calls of the model to the response format, the chunks carry their index.
+func toolCalls(calls []openai.ChatCompletionChunkChoiceDeltaToolCall, indexed bool) []toolCall {
+	result := make([]toolCall, 0, len(calls))
+	for i, call := range calls {
+		tc := toolCall{ID: call.ID, Type: "function"}
+		if indexed {
+			tc.Index = &i
+		}
+		tc.Function.Name = call.Function.Name
+		tc.Function.Arguments = call.Function.Arguments
+		result = append(result, tc)
+	}
+	return result
+}
+
+func finishReason(round llm.Round) *string {
+	reason := "stop"
+	if len(round.ToolCalls) > 0 {
+		reason = "tool_calls"
+	}
+	return &reason
+}
+
+// chunkWriter sends each write of the answer as a chunk of server sent events.
+type chunkWriter struct {
+	w       http.ResponseWriter
+	c       completion
+	started bool
+	// role is sent in the delta of the first chunk only.
+	roleSent bool
+}
+
+func (s *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	content := string(p)
+	if err := s.send(&message{Content: &content}, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send sends a chunk with the delta of the answer.
+func (s *chunkWriter) send(delta *message, finish *string) error {
+	if !s.roleSent {
+		delta.Role = "assistant"
+		s.roleSent = true
+	}
+	s.c.Choices = []choice{{Delta: delta, FinishReason: finish}}
+	return s.event(s.c)
+}
+
+// event sends a data event, the headers are sent with the first event.
+func (s *chunkWriter) event(v any) error {
+	s.start()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *chunkWriter) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *chunkWriter) flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeChatError responds an error of the model, the status of the model server is kept.
+func writeChatError(w http.ResponseWriter, err error) {
+	status := llm.StatusCode(err)
+	if status == 0 {
+		status = http.StatusBadGateway
+		if errors.Is(err, llm.ErrBudgetExceeded) {
+			status = http.StatusTooManyRequests
+		}
+	}
+	slog.Error("chat completion failed", "status", status, "err", err)
+	writeError(w, status, errorType(err), err.Error())
+}
+
+func errorType(err error) string {
+	status := llm.StatusCode(err)
+	if status >= 400 && status < 500 {
+		return "invalid_request_error"
+	}
+	return "api_error"
+}
+
+func errorBody(typ, msg string) any {
+	return map[string]any{"error": map[string]any{"message": msg, "type": typ}}
+}
+
+func writeError(w http.ResponseWriter, status int, typ, msg string) {
+	writeJSON(w, status, errorBody(typ, msg))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newID returns a random id of a chat completion.
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/utils"
+)
+
+// upstream is a fake OpenAI server which streams "hello" and records the model and key of the requests.
+type upstream struct {
+	models []string
+	keys   []string
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	u.models = append(u.models, req.Model)
+	u.keys = append(u.keys, r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, part := range []string{"hel", "lo"} {
+		fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", req.Model, part)
+	}
+	fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n", req.Model)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func newGateway(t *testing.T, clientKey string) (*httptest.Server, *upstream) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	up := &upstream{}
+	upstreamServer := httptest.NewServer(up)
+	t.Cleanup(upstreamServer.Close)
+	conf := &utils.AppConf{
+		LLM: utils.LLM{Provider: "openai", Gateway: upstreamServer.URL, ApiKey: "secret", Model: "big"},
+		LLMs: map[string]utils.LLM{
+			"fast": {Model: "small"},
+		},
+	}
+	s := httptest.NewServer(New(conf, nil, clientKey).Handler())
+	t.Cleanup(s.Close)
+	return s, up
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestChatCompletion(t *testing.T) {
+	s, up := newGateway(t, "")
+	resp := post(t, s.URL, `{"model":"fast","messages":[{"role":"user","content":"hi"}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	var c struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int64 `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Object != "chat.completion" || c.Model != "small" || len(c.Choices) != 1 {
+		t.Fatalf("unexpected completion %+v", c)
+	}
+	if choice := c.Choices[0]; choice.Message.Role != "assistant" || choice.Message.Content != "hello" || choice.FinishReason != "stop" {
+		t.Fatalf("unexpected choice %+v", choice)
+	}
+	if c.Usage.TotalTokens != 5 {
+		t.Fatalf("unexpected usage %+v", c.Usage)
+	}
+	if len(up.models) != 1 || up.models[0] != "small" || up.keys[0] != "Bearer secret" {
+		t.Fatalf("unexpected upstream requests %v %v", up.models, up.keys)
+	}
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	s, up := newGateway(t, "")
+	resp := post(t, s.URL, `{"messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	if len(events) != 5 || events[4] != "[DONE]" {
+		t.Fatalf("unexpected events %q", events)
+	}
+
+	type chunk struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Delta struct {
+				Role    string  `json:"role"`
+				Content *string `json:"content"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *struct {
+			TotalTokens int64 `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	chunks := make([]chunk, 4)
+	content := ""
+	for i := range chunks {
+		if err := json.Unmarshal([]byte(events[i]), &chunks[i]); err != nil {
+			t.Fatal(err)
+		}
+		if chunks[i].Object != "chat.completion.chunk" || chunks[i].Model != "big" {
+			t.Fatalf("unexpected chunk %s", events[i])
+		}
+		if len(chunks[i].Choices) > 0 && chunks[i].Choices[0].Delta.Content != nil {
+			content += *chunks[i].Choices[0].Delta.Content
+		}
+	}
+	if content != "hello" || chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Fatalf("unexpected content %q in %q", content, events)
+	}
+	if finish := chunks[2].Choices[0].FinishReason; finish == nil || *finish != "stop" {
+		t.Fatalf("expected the finish chunk, got %s", events[2])
+	}
+	if len(chunks[3].Choices) != 0 || chunks[3].Usage == nil || chunks[3].Usage.TotalTokens != 5 {
+		t.Fatalf("expected the usage chunk, got %s", events[3])
+	}
+	if up.models[0] != "big" {
+		t.Fatalf("expected the default model, got %v", up.models)
+	}
+}
+
+func TestClientKeyAndModels(t *testing.T) {
+	s, up := newGateway(t, "local")
+	resp := post(t, s.URL, `{"messages":[{"role":"user","content":"hi"}]}`)
+	if resp.StatusCode != http.StatusUnauthorized || len(up.models) != 0 {
+		t.Fatalf("expected unauthorized, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer local")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var list struct {
+		Object string `json:"object"`
+		Data   []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || list.Object != "list" || len(list.Data) != 2 || list.Data[0].ID != "big" || list.Data[1].ID != "fast" {
+		t.Fatalf("unexpected models %d %s", resp.StatusCode, body)
+	}
+}
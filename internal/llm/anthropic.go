@@ -0,0 +1,378 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/spf13/viper"
+)
+
+const (
+	anthropicGateway = "https://api.anthropic.com/v1"
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens is the max tokens of the answer, the thinking budget is added to it.
+	anthropicMaxTokens = 8192
+)
+
+// anthropicThinkingBudget maps the reasoning effort to the thinking budget tokens.
+var anthropicThinkingBudget = map[string]int{
+	"minimal": 1024,
+	"low":     2048,
+	"medium":  8192,
+	"high":    16384,
+}
+
+// anthropicProvider talks to the Anthropic Messages API directly.
+type anthropicProvider struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+	// thinking keeps the thinking blocks of the answers with tool calls, keyed by the first tool call id.
+	// They must be sent back with the tool calls in the following requests.
+	thinking map[string][]anthropicBlock
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicChoice   `json:"tool_choice,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Thinking    *anthropicThinking `json:"thinking,omitempty"`
+	Stream      bool               `json:"stream"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicChoice struct {
+	Type string `json:"type"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// anthropicBlock is a content block, its fields are used by different block types.
+type anthropicBlock struct {
+	Type string `json:"type"`
+	// text
+	Text string `json:"text,omitempty"`
+	// image
+	Source *anthropicSource `json:"source,omitempty"`
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+	// thinking and redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+}
+
+// anthropicEvent is a server sent event of the streaming response.
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropicProvider(conf *utils.LLM) *anthropicProvider {
+	gateway := strings.TrimRight(utils.Or(conf.Gateway, anthropicGateway), "/")
+	return &anthropicProvider{
+		url:        gateway + "/messages",
+		apiKey:     conf.ApiKey,
+		httpClient: &http.Client{},
+		thinking:   make(map[string][]anthropicBlock),
+	}
+}
+
+// buildRequest converts a chat completion request to a Messages API request.
+func (p *anthropicProvider) buildRequest(req openai.ChatCompletionNewParams) (*anthropicRequest, error) {
+	wr, err := decodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &anthropicRequest{
+		Model:     wr.Model,
+		MaxTokens: anthropicMaxTokens,
+		Stream:    true,
+	}
+	if budget, ok := anthropicThinkingBudget[wr.ReasoningEffort]; ok {
+		ar.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		ar.MaxTokens += budget
+	} else if wr.Temperature != nil {
+		// temperature is not allowed with thinking, and it's range is [0, 1]
+		ar.Temperature = openai.Ptr(min(*wr.Temperature, 1))
+	}
+
+	if wr.toolsDisabled() {
+		ar.ToolChoice = &anthropicChoice{Type: "none"}
+	}
+	for _, tool := range wr.Tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		ar.Tools = append(ar.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	var system []string
+	for _, m := range wr.Messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, m.text())
+		case "user":
+			ar.appendBlocks("user", anthropicContent(m.parts())...)
+		case "assistant":
+			var blocks []anthropicBlock
+			if len(m.ToolCalls) > 0 {
+				blocks = append(blocks, p.thinking[m.ToolCalls[0].ID]...)
+			}
+			if text := m.text(); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, call := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: validJSONObject(call.Function.Arguments),
+				})
+			}
+			ar.appendBlocks("assistant", blocks...)
+		case "tool":
+			ar.appendBlocks("user", anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   m.text(),
+			})
+		}
+	}
+	ar.System = strings.Join(system, "\n")
+	return ar, nil
+}
+
+// appendBlocks appends blocks to the conversation, consecutive blocks of same role are merged into one message.
+func (r *anthropicRequest) appendBlocks(role string, blocks ...anthropicBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == role {
+		r.Messages[n-1].Content = append(r.Messages[n-1].Content, blocks...)
+		return
+	}
+	r.Messages = append(r.Messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// anthropicContent converts text and image parts to content blocks.
+func anthropicContent(parts []wirePart) []anthropicBlock {
+	blocks := make([]anthropicBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			if mimeType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicSource{Type: "base64", MediaType: mimeType, Data: data}})
+			} else {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicSource{Type: "url", URL: part.ImageURL.URL}})
+			}
+		}
+	}
+	return blocks
+}
+
+// Stream implements the Provider interface.
+func (p *anthropicProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	var round Round
+
+	ar, err := p.buildRequest(req)
+	if err != nil {
+		return round, err
+	}
+	body, err := json.Marshal(ar)
+	if err != nil {
+		return round, err
+	}
+	slog.Debug("Anthropic request", "body", string(body))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return round, err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return round, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return round, newStatusError(resp)
+	}
+
+	return p.readStream(resp.Body, w)
+}
+
+// readStream reads the server sent events, text is written to w, tool calls and usage are collected.
+func (p *anthropicProvider) readStream(r io.Reader, w io.Writer) (Round, error) {
+	var round Round
+	var content strings.Builder
+	var usage anthropicUsage
+	blocks := make(map[int]*anthropicBlock)
+	arguments := make(map[int]*strings.Builder)
+	verbose := viper.GetInt("verbose")
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		if verbose >= 3 {
+			slog.Debug("stream chunk", "chunk", data)
+		}
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return round, fmt.Errorf("invalid stream event: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "content_block_start":
+			block := event.ContentBlock
+			blocks[event.Index] = &block
+			if block.Type == "tool_use" {
+				arguments[event.Index] = &strings.Builder{}
+			}
+		case "content_block_delta":
+			block, ok := blocks[event.Index]
+			if !ok {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				w.Write([]byte(event.Delta.Text))
+				content.WriteString(event.Delta.Text)
+			case "input_json_delta":
+				arguments[event.Index].WriteString(event.Delta.PartialJSON)
+			case "thinking_delta":
+				block.Thinking += event.Delta.Thinking
+				if verbose >= 2 {
+					showReasoning(event.Delta.Thinking)
+				}
+			case "signature_delta":
+				block.Signature += event.Delta.Signature
+			}
+		case "message_delta":
+			usage.OutputTokens = max(usage.OutputTokens, event.Usage.OutputTokens)
+		case "error":
+			return round, fmt.Errorf("%s: %s", event.Error.Type, event.Error.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return round, err
+	}
+
+	indexes := make([]int, 0, len(blocks))
+	for index := range blocks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var thinking []anthropicBlock
+	for _, index := range indexes {
+		block := blocks[index]
+		switch block.Type {
+		case "thinking":
+			thinking = append(thinking, anthropicBlock{Type: "thinking", Thinking: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			thinking = append(thinking, anthropicBlock{Type: "redacted_thinking", Data: block.Data})
+		case "tool_use":
+			call := openai.ChatCompletionChunkChoiceDeltaToolCall{
+				Index: int64(len(round.ToolCalls)),
+				ID:    block.ID,
+				Type:  "function",
+			}
+			call.Function.Name = block.Name
+			call.Function.Arguments = arguments[index].String()
+			round.ToolCalls = append(round.ToolCalls, call)
+		}
+	}
+	if len(round.ToolCalls) > 0 && len(thinking) > 0 {
+		p.thinking[round.ToolCalls[0].ID] = thinking
+	}
+
+	round.Content = content.String()
+	round.Usage.PromptTokens = usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	round.Usage.PromptTokensDetails.CachedTokens = usage.CacheReadInputTokens
+	round.Usage.CompletionTokens = usage.OutputTokens
+	round.Usage.TotalTokens = round.Usage.PromptTokens + round.Usage.CompletionTokens
+	return round, nil
+}
@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// anthropicStandIn is a local stand-in of the Messages API, it replies the events in order and records the requests.
+func anthropicStandIn(t *testing.T, replies ...[]string) (*httptest.Server, *[]anthropicRequest) {
+	t.Helper()
+	var requests []anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, `{"type":"error","error":{"type":"authentication_error","message":"bad key"}}`, http.StatusUnauthorized)
+			return
+		}
+		var req anthropicRequest
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		requests = append(requests, req)
+		events := replies[min(len(requests), len(replies))-1]
+		w.Header().Set("content-type", "text/event-stream")
+		for _, event := range events {
+			var e struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(event), &e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, event)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestAnthropic(url string) *anthropicProvider {
+	return newAnthropicProvider(&utils.LLM{Provider: "anthropic", Gateway: url + "/v1/", ApiKey: "test-key"})
+}
+
+func TestAnthropicStreamsTextAndToolUse(t *testing.T) {
+	server, requests := anthropicStandIn(t, []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"need to add"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"add."}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"add","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"a\":1,"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"b\":2}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	})
+	p := newTestAnthropic(server.URL)
+
+	req := openai.ChatCompletionNewParams{
+		Model: "claude-test",
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("be brief"),
+			openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
+				openai.TextContentPart("what is 1+2?"),
+				openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: "data:image/png;base64,iVBOR"}),
+			}),
+		},
+		Tools: []openai.ChatCompletionToolUnionParam{
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:       "add",
+				Parameters: shared.FunctionParameters{"type": "object", "properties": map[string]any{"a": map[string]any{"type": "number"}}},
+			}),
+		},
+		ReasoningEffort: shared.ReasoningEffort("low"),
+		Temperature:     openai.Float(1.5),
+	}
+	var out bytes.Buffer
+	round, err := p.Stream(context.Background(), req, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "Let me add." || round.Content != "Let me add." {
+		t.Fatalf("unexpected content %q", out.String())
+	}
+	if len(round.ToolCalls) != 1 || round.ToolCalls[0].ID != "toolu_1" || round.ToolCalls[0].Function.Arguments != `{"a":1,"b":2}` {
+		t.Fatalf("unexpected tool calls %+v", round.ToolCalls)
+	}
+	if round.Usage.PromptTokens != 15 || round.Usage.CompletionTokens != 20 || round.Usage.PromptTokensDetails.CachedTokens != 5 {
+		t.Fatalf("unexpected usage %+v", round.Usage)
+	}
+
+	sent := (*requests)[0]
+	if sent.System != "be brief" || sent.Thinking == nil || sent.Thinking.BudgetTokens != 2048 || sent.Temperature != nil {
+		t.Fatalf("unexpected request %+v", sent)
+	}
+	if len(sent.Tools) != 1 || sent.Tools[0].Name != "add" || !strings.Contains(string(sent.Tools[0].InputSchema), `"properties"`) {
+		t.Fatalf("unexpected tools %+v", sent.Tools)
+	}
+	user := sent.Messages[0]
+	if user.Role != "user" || len(user.Content) != 2 || user.Content[1].Source.Type != "base64" || user.Content[1].Source.MediaType != "image/png" {
+		t.Fatalf("unexpected user message %+v", user)
+	}
+}
+
+func TestAnthropicSendsToolResultsWithThinking(t *testing.T) {
+	server, requests := anthropicStandIn(t, []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"t","signature":"s"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_a","name":"add","input":{}}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_b","name":"add","input":{}}}`,
+		`{"type":"message_stop"}`,
+	}, []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"3 and 7"}}`,
+		`{"type":"message_stop"}`,
+	})
+	p := newTestAnthropic(server.URL)
+
+	messages := []openai.ChatCompletionMessageParamUnion{openai.UserMessage("add them")}
+	round, err := p.Stream(context.Background(), openai.ChatCompletionNewParams{Model: "claude-test", Messages: messages}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.ToolCalls) != 2 || round.ToolCalls[1].Function.Arguments != "" {
+		t.Fatalf("unexpected tool calls %+v", round.ToolCalls)
+	}
+
+	calls := make([]openai.ChatCompletionMessageToolCallUnionParam, 0)
+	for _, call := range round.ToolCalls {
+		calls = append(calls, openai.ChatCompletionMessageToolCallUnionParam{OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+			ID:       call.ID,
+			Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{Name: call.Function.Name, Arguments: call.Function.Arguments},
+		}})
+	}
+	messages = append(messages,
+		openai.ChatCompletionMessageParamUnion{OfAssistant: &openai.ChatCompletionAssistantMessageParam{ToolCalls: calls}},
+		openai.ToolMessage("3", "toolu_a"),
+		openai.ToolMessage("7", "toolu_b"),
+	)
+	var out bytes.Buffer
+	if _, err := p.Stream(context.Background(), openai.ChatCompletionNewParams{Model: "claude-test", Messages: messages}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "3 and 7" {
+		t.Fatalf("unexpected answer %q", out.String())
+	}
+
+	sent := (*requests)[1]
+	if len(sent.Messages) != 3 {
+		t.Fatalf("expected user, assistant, user messages, got %+v", sent.Messages)
+	}
+	assistant := sent.Messages[1]
+	if assistant.Content[0].Type != "thinking" || assistant.Content[0].Signature != "s" || assistant.Content[1].Type != "tool_use" || string(assistant.Content[2].Input) != "{}" {
+		t.Fatalf("unexpected assistant message %+v", assistant)
+	}
+	results := sent.Messages[2]
+	if results.Role != "user" || len(results.Content) != 2 || results.Content[1].ToolUseID != "toolu_b" || results.Content[1].Content != "7" {
+		t.Fatalf("tool results are not merged into one user message: %+v", results)
+	}
+}
+
+func TestAnthropicReturnsStatusError(t *testing.T) {
+	server, _ := anthropicStandIn(t, nil)
+	p := newAnthropicProvider(&utils.LLM{Gateway: server.URL + "/v1", ApiKey: "wrong"})
+	_, err := p.Stream(context.Background(), openai.ChatCompletionNewParams{Model: "claude-test"}, io.Discard)
+	statusErr, ok := err.(*statusError)
+	if !ok || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 status error, got %v", err)
+	}
+}
+
+func TestNewProviderByProvider(t *testing.T) {
+	if _, ok := NewProvider(&utils.LLM{Provider: "anthropic"}).(*anthropicProvider); !ok {
+		t.Fatal("expected the native anthropic provider")
+	}
+	if _, ok := NewProvider(&utils.LLM{Provider: "ollama"}).(*ollamaProvider); !ok {
+		t.Fatal("expected the native ollama provider")
+	}
+	if _, ok := NewProvider(&utils.LLM{Provider: "openai", API: "responses"}).(*responsesProvider); !ok {
+		t.Fatal("expected the responses api of an openai compatible provider")
+	}
+	if _, ok := NewProvider(&utils.LLM{Provider: "deepseek"}).(*openaiProvider); !ok {
+		t.Fatal("expected an openai compatible provider")
+	}
+}
+
+func TestDisabledToolsOfNativeProviders(t *testing.T) {
+	req := openai.ChatCompletionNewParams{
+		Model:      "test",
+		Messages:   []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+		Tools:      []openai.ChatCompletionToolUnionParam{openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{Name: "search"})},
+		ToolChoice: openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String("none")},
+	}
+	ar, err := newTestAnthropic("http://localhost").buildRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.ToolChoice == nil || ar.ToolChoice.Type != "none" || len(ar.Tools) != 1 {
+		t.Fatalf("unexpected anthropic tools %+v %+v", ar.ToolChoice, ar.Tools)
+	}
+	or, err := newOllamaProvider(&utils.LLM{}).buildRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(or.Tools) != 0 {
+		t.Fatalf("unexpected ollama tools %+v", or.Tools)
+	}
+}
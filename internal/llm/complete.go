@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"io"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// Complete answers a chat completion request of a client with the model of conf, the answer is streamed to w.
+// When the request has no tools of its own, the tools of the MCP servers of the prompt are offered to the model
+// and executed in the tool calling loop, otherwise the tool calls of the model are returned for the client to execute.
+// The loop is limited like Chat, the default limits are used when the prompt sets none, and Prompt.Timeout aborts it.
+func Complete(ctx context.Context, conf *utils.AppConf, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	provider := newChainProvider(conf)
+	defer func() {
+		recordUsage(provider.entries, conf.Prompt.Tool)
+	}()
+
+	if conf.Prompt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Prompt.Timeout)
+		defer cancel()
+	}
+	if conf.Prompt.MaxToolRounds <= 0 {
+		conf.Prompt.MaxToolRounds = DefaultMaxToolRounds
+	}
+	if conf.Prompt.MaxToolFailures <= 0 {
+		conf.Prompt.MaxToolFailures = DefaultMaxToolFailures
+	}
+
+	req.Model = conf.LLM.Model
+	if req.ReasoningEffort == "" && conf.LLM.ReasonEffort != "" {
+		req.ReasoningEffort = shared.ReasoningEffort(conf.LLM.ReasonEffort)
+	}
+	req.StreamOptions = openai.ChatCompletionStreamOptionsParam{
+		IncludeUsage: openai.Bool(true),
+	}
+
+	servers := conf.Prompt.MCPServers
+	if len(req.Tools) > 0 || servers == nil || len(servers.OpenAITools()) == 0 {
+		return provider.Stream(ctx, req, w)
+	}
+	req.Tools = servers.OpenAITools()
+	messages, usage, err := toolLoop(ctx, provider, req, req.Messages, conf, w, "")
+	if err != nil {
+		return Round{}, err
+	}
+	return Round{Content: lastAnswer(messages), Usage: usage}, nil
+}
+
+// StatusCode returns the http status of an error responded by the model server, it's 0 for other errors.
+func StatusCode(err error) int {
+	status, _ := errorStatus(err)
+	return status
+}
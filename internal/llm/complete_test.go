@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+func TestCompleteLimitsToolRounds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	// the model calls the echo tool until the tools are disabled, the tool is served by the same server
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte("echo"))
+			return
+		}
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(body), `"tool_choice":"none"`) {
+			fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","model":"test","choices":[{"index":0,"delta":{"content":"done"},"finish_reason":"stop"}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","model":"test","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"echo","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "echo.mcp.yaml")
+	err := os.WriteFile(config, []byte(`
+tools:
+  - name: "echo"
+    url: "`+srv.URL+`"
+    method: "GET"
+    inputSchema:
+      type: "object"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, err := mcps.New(context.Background(), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer servers.Shutdown()
+
+	// the prompt of a client request sets no limit, the default one applies
+	conf := &utils.AppConf{
+		LLM:    utils.LLM{Gateway: srv.URL, ApiKey: "key", Model: "test"},
+		Prompt: &utils.Prompt{MCPServers: servers, Tool: "serve"},
+	}
+	req := openai.ChatCompletionNewParams{Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")}}
+	var out strings.Builder
+	round, err := Complete(context.Background(), conf, req, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the content is streamed to the client as is, without separators between the rounds
+	if out.String() != "done" {
+		t.Fatalf("unexpected content %q", out.String())
+	}
+	if n := requests.Load(); n != DefaultMaxToolRounds+2 || round.Content != "done" {
+		t.Fatalf("expected %d requests and the final answer, got %d and %q", DefaultMaxToolRounds+2, n, round.Content)
+	}
+}
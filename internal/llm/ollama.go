@@ -0,0 +1,275 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/spf13/viper"
+)
+
+const ollamaGateway = "http://localhost:11434"
+
+// ollamaProvider talks to the Ollama /api/chat protocol.
+type ollamaProvider struct {
+	baseURL    string
+	keepAlive  string
+	numCtx     int
+	httpClient *http.Client
+}
+
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []wireTool      `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Think     *bool           `json:"think,omitempty"`
+	Format    json.RawMessage `json:"format,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+	KeepAlive any             `json:"keep_alive,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChunk struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func newOllamaProvider(conf *utils.LLM) *ollamaProvider {
+	// the gateway may be the OpenAI compatible endpoint, use the native one instead
+	baseURL := strings.TrimRight(utils.Or(conf.Gateway, ollamaGateway), "/")
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/v1"), "/api")
+	return &ollamaProvider{
+		baseURL:    baseURL,
+		keepAlive:  conf.KeepAlive,
+		numCtx:     conf.NumCtx,
+		httpClient: &http.Client{},
+	}
+}
+
+// buildRequest converts a chat completion request to an /api/chat request.
+func (p *ollamaProvider) buildRequest(req openai.ChatCompletionNewParams) (*ollamaRequest, error) {
+	wr, err := decodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	or := &ollamaRequest{
+		Model:   wr.Model,
+		Tools:   wr.Tools,
+		Stream:  true,
+		Options: make(map[string]any),
+	}
+	if wr.toolsDisabled() {
+		// ollama has no tool choice, the tools are not sent, the tool calls of the history are kept
+		or.Tools = nil
+	}
+	if wr.Temperature != nil {
+		or.Options["temperature"] = *wr.Temperature
+	}
+	if p.numCtx > 0 {
+		or.Options["num_ctx"] = p.numCtx
+	}
+	if p.keepAlive != "" {
+		// a plain number is seconds, otherwise it's a duration such as "5m"
+		if seconds, err := strconv.Atoi(p.keepAlive); err == nil {
+			or.KeepAlive = seconds
+		} else {
+			or.KeepAlive = p.keepAlive
+		}
+	}
+	if wr.ReasoningEffort != "" {
+		or.Think = openai.Ptr(wr.ReasoningEffort != "none")
+	}
+	if wr.ResponseFormat != nil {
+		switch wr.ResponseFormat.Type {
+		case "json_object":
+			or.Format = json.RawMessage(`"json"`)
+		case "json_schema":
+			if wr.ResponseFormat.JSONSchema != nil {
+				or.Format = wr.ResponseFormat.JSONSchema.Schema
+			}
+		}
+	}
+
+	toolNames := make(map[string]string)
+	for _, m := range wr.Messages {
+		om := ollamaMessage{Role: m.Role}
+		switch m.Role {
+		case "developer":
+			om.Role = "system"
+			om.Content = m.text()
+		case "assistant":
+			om.Content = m.text()
+			for _, call := range m.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				var tc ollamaToolCall
+				tc.Function.Name = call.Function.Name
+				tc.Function.Arguments = validJSONObject(call.Function.Arguments)
+				om.ToolCalls = append(om.ToolCalls, tc)
+			}
+		case "tool":
+			om.Content = m.text()
+			om.ToolName = toolNames[m.ToolCallID]
+		default:
+			var texts []string
+			for _, part := range m.parts() {
+				switch part.Type {
+				case "text":
+					texts = append(texts, part.Text)
+				case "image_url":
+					// only inline images are supported
+					if _, data, ok := parseDataURL(part.ImageURL.URL); ok {
+						om.Images = append(om.Images, data)
+					} else {
+						slog.Warn("ollama only supports local images", "url", part.ImageURL.URL)
+					}
+				}
+			}
+			om.Content = strings.Join(texts, "\n")
+		}
+		or.Messages = append(or.Messages, om)
+	}
+	return or, nil
+}
+
+// Stream implements the Provider interface.
+func (p *ollamaProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	var round Round
+
+	or, err := p.buildRequest(req)
+	if err != nil {
+		return round, err
+	}
+	body, err := json.Marshal(or)
+	if err != nil {
+		return round, err
+	}
+	slog.Debug("Ollama request", "body", string(body))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return round, err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return round, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return round, newStatusError(resp)
+	}
+
+	return readOllamaStream(resp.Body, w)
+}
+
+// readOllamaStream reads the NDJSON stream, text is written to w, tool calls and usage are collected.
+func readOllamaStream(r io.Reader, w io.Writer) (Round, error) {
+	var round Round
+	var content strings.Builder
+	verbose := viper.GetInt("verbose")
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if verbose >= 3 {
+			slog.Debug("stream chunk", "chunk", string(line))
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return round, fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return round, errors.New(chunk.Error)
+		}
+		if verbose >= 2 {
+			showReasoning(chunk.Message.Thinking)
+		}
+		w.Write([]byte(chunk.Message.Content))
+		content.WriteString(chunk.Message.Content)
+		for _, call := range chunk.Message.ToolCalls {
+			// ollama does not give tool calls an id
+			index := int64(len(round.ToolCalls))
+			tc := openai.ChatCompletionChunkChoiceDeltaToolCall{
+				Index: index,
+				ID:    fmt.Sprintf("call_%d", index),
+				Type:  "function",
+			}
+			tc.Function.Name = call.Function.Name
+			tc.Function.Arguments = string(call.Function.Arguments)
+			round.ToolCalls = append(round.ToolCalls, tc)
+		}
+		if chunk.Done {
+			round.Usage.PromptTokens = chunk.PromptEvalCount
+			round.Usage.CompletionTokens = chunk.EvalCount
+			round.Usage.TotalTokens = chunk.PromptEvalCount + chunk.EvalCount
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return round, err
+	}
+	round.Content = content.String()
+	return round, nil
+}
+
+// Models implements the ModelLister interface, it lists the locally pulled models.
+func (p *ollamaProvider) Models(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, newStatusError(resp)
+	}
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
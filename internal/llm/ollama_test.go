@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+func TestOllamaStreamsToolCallsAndImages(t *testing.T) {
+	var sent map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			json.NewDecoder(r.Body).Decode(&sent)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"checking"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"add","arguments":{"a":1}}}]},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":12,"eval_count":7}`)
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"qwen3:8b"},{"name":"llava:7b"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p := newOllamaProvider(&utils.LLM{Provider: "ollama", Gateway: server.URL + "/v1", KeepAlive: "-1", NumCtx: 8192})
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
+			openai.TextContentPart("what is in it?"),
+			openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: "data:image/jpeg;base64,/9j/"}),
+		}),
+		{OfAssistant: &openai.ChatCompletionAssistantMessageParam{ToolCalls: []openai.ChatCompletionMessageToolCallUnionParam{{
+			OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+				ID:       "call_0",
+				Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{Name: "look", Arguments: `{"x":1}`},
+			},
+		}}}},
+		openai.ToolMessage("a cat", "call_0"),
+	}
+	var out bytes.Buffer
+	round, err := p.Stream(context.Background(), openai.ChatCompletionNewParams{Model: "llava:7b", Messages: messages}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "checking" {
+		t.Fatalf("unexpected content %q", out.String())
+	}
+	if len(round.ToolCalls) != 1 || round.ToolCalls[0].Function.Name != "add" || round.ToolCalls[0].Function.Arguments != `{"a":1}` || round.ToolCalls[0].ID == "" {
+		t.Fatalf("unexpected tool calls %+v", round.ToolCalls)
+	}
+	if round.Usage.PromptTokens != 12 || round.Usage.CompletionTokens != 7 {
+		t.Fatalf("unexpected usage %+v", round.Usage)
+	}
+
+	if sent["keep_alive"] != float64(-1) || MGet(sent, "options.num_ctx", 0.0) != 8192 {
+		t.Fatalf("options are not sent: %v", sent)
+	}
+	if MGet(sent, "messages.0.images.0", "") != "/9j/" {
+		t.Fatalf("image is not sent: %v", sent["messages"])
+	}
+	if MGet(sent, "messages.1.tool_calls.0.function.arguments.x", 0.0) != 1 {
+		t.Fatalf("tool call arguments should be an object: %v", sent["messages"])
+	}
+	if MGet(sent, "messages.2.tool_name", "") != "look" {
+		t.Fatalf("tool result should have the tool name: %v", sent["messages"])
+	}
+
+	models, err := p.Models(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0] != "qwen3:8b" {
+		t.Fatalf("unexpected models %v", models)
+	}
+}
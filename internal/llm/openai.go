@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/spf13/viper"
+)
+
+// openaiProvider talks to an OpenAI compatible chat completion api.
+type openaiProvider struct {
+	client openai.Client
+}
+
+func newOpenAIProvider(conf *utils.LLM) *openaiProvider {
+	return &openaiProvider{
+		client: openai.NewClient(
+			option.WithAPIKey(conf.ApiKey),
+			option.WithBaseURL(conf.Gateway),
+			option.WithHeaderAdd("x-portkey-provider", conf.Provider),
+			// the retries are done by chainProvider
+			option.WithMaxRetries(0),
+		),
+	}
+}
+
+func debugChunk(c string) {
+	var verbose = viper.GetInt("verbose")
+	if verbose >= 3 {
+		// detailed debug info
+		slog.Debug("stream chunk", "chunk", c)
+	} else if verbose >= 2 {
+		// only log reason content
+		var chunk map[string]any
+		err := json.Unmarshal([]byte(c), &chunk)
+		if err != nil {
+			slog.Debug("stream chunk", "chunk", c)
+			return
+		}
+		showReasoning(MGet(chunk, "choices.0.delta.reasoning_content", ""))
+	}
+
+}
+
+// Stream implements the Provider interface.
+func (p *openaiProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	var round Round
+
+	s := p.client.Chat.Completions.NewStreaming(ctx, req)
+	if s.Err() != nil {
+		return round, s.Err()
+	}
+	defer s.Close()
+
+	var content strings.Builder
+	toolCalls := make(map[int64]*openai.ChatCompletionChunkChoiceDeltaToolCall)
+	for s.Next() {
+		cur := s.Current()
+		debugChunk(cur.RawJSON())
+		for _, c := range cur.Choices {
+			w.Write([]byte(c.Delta.Content))
+			content.WriteString(c.Delta.Content)
+			for _, toolCall := range c.Delta.ToolCalls {
+				tc, ok := toolCalls[toolCall.Index]
+				if !ok {
+					tc = &toolCall
+					toolCalls[toolCall.Index] = tc
+				} else {
+					tc.Function.Arguments += toolCall.Function.Arguments
+				}
+			}
+		}
+		if cur.Usage.TotalTokens > 0 {
+			round.Usage = cur.Usage
+		}
+	}
+	if s.Err() != nil {
+		return round, s.Err()
+	}
+
+	round.Content = content.String()
+	for _, tc := range toolCalls {
+		round.ToolCalls = append(round.ToolCalls, *tc)
+	}
+	sort.Slice(round.ToolCalls, func(i, j int) bool {
+		return round.ToolCalls[i].Index < round.ToolCalls[j].Index
+	})
+	return round, nil
+}
+
+// Models implements the ModelLister interface.
+func (p *openaiProvider) Models(ctx context.Context) ([]string, error) {
+	var models []string
+	iter := p.client.Models.ListAutoPaging(ctx)
+	for iter.Next() {
+		models = append(models, iter.Current().ID)
+	}
+	return models, iter.Err()
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+// Round is the result of one request to the model in the tool calling loop.
+type Round struct {
+	// Content is the text answered by the model, it is also streamed to the writer.
+	Content string
+	// ToolCalls are the tools the model want to call, ordered by their index.
+	ToolCalls []openai.ChatCompletionChunkChoiceDeltaToolCall
+	Usage     openai.CompletionUsage
+}
+
+// Provider sends a request to a model and streams the answer to w.
+// The request and the messages use the OpenAI chat completion format, providers convert them to their own protocol.
+type Provider interface {
+	Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error)
+}
+
+// ModelLister is implemented by providers which can list the available models.
+type ModelLister interface {
+	Models(ctx context.Context) ([]string, error)
+}
+
+// NewProvider creates the provider selected by conf.Provider.
+// Providers without a native implementation are sent to an OpenAI compatible gateway,
+// conf.API selects its wire format.
+func NewProvider(conf *utils.LLM) Provider {
+	switch strings.ToLower(conf.Provider) {
+	case "anthropic", "claude":
+		return newAnthropicProvider(conf)
+	case "ollama":
+		return newOllamaProvider(conf)
+	}
+	if strings.EqualFold(conf.API, "responses") {
+		return newResponsesProvider(conf)
+	}
+	return newOpenAIProvider(conf)
+}
+
+// statusError is returned by the native providers when the server responds a non 2xx status.
+type statusError struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), strings.TrimSpace(e.Body))
+}
+
+// newStatusError reads the response body into a statusError.
+func newStatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return &statusError{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(body)}
+}
+
+// showReasoning prints the reasoning of the model to stderr in gray.
+func showReasoning(text string) {
+	if len(text) > 0 {
+		fmt.Fprintf(os.Stderr, "\033[37m%s\033[0m", text)
+	}
+}
@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/responses"
+	"github.com/spf13/viper"
+)
+
+// responsesProvider talks to the OpenAI Responses API.
+type responsesProvider struct {
+	client openai.Client
+	// lastID is the id of the last response, and lastLen is the number of messages it covers.
+	// The following request in the tool loop is chained by previous_response_id and only sends the new messages,
+	// so the reasoning items are kept by the server. lastCalls is the count of the function calls of the last response,
+	// the full history is sent when the answer in the messages has not the same calls, e.g. the calls are dropped,
+	// as the server rejects a request without the outputs of the calls it has seen.
+	lastID    string
+	lastLen   int
+	lastCalls int
+}
+
+// responsesRequest is the JSON form of responses.ResponseNewParams, which is built from the wire request.
+type responsesRequest struct {
+	Model              string           `json:"model"`
+	Instructions       string           `json:"instructions,omitempty"`
+	Input              []map[string]any `json:"input"`
+	Tools              []map[string]any `json:"tools,omitempty"`
+	ToolChoice         string           `json:"tool_choice,omitempty"`
+	Temperature        *float64         `json:"temperature,omitempty"`
+	Reasoning          map[string]any   `json:"reasoning,omitempty"`
+	Text               map[string]any   `json:"text,omitempty"`
+	PreviousResponseID string           `json:"previous_response_id,omitempty"`
+}
+
+func newResponsesProvider(conf *utils.LLM) *responsesProvider {
+	return &responsesProvider{client: newOpenAIProvider(conf).client}
+}
+
+// buildRequest converts a chat completion request to a Responses API request.
+func (p *responsesProvider) buildRequest(req openai.ChatCompletionNewParams) (responses.ResponseNewParams, error) {
+	var params responses.ResponseNewParams
+	wr, err := decodeRequest(req)
+	if err != nil {
+		return params, err
+	}
+
+	rr := responsesRequest{Model: wr.Model}
+	if wr.ReasoningEffort != "" {
+		rr.Reasoning = map[string]any{"effort": wr.ReasoningEffort, "summary": "auto"}
+	} else {
+		rr.Temperature = wr.Temperature
+	}
+	if wr.toolsDisabled() {
+		rr.ToolChoice = "none"
+	}
+	for _, tool := range wr.Tools {
+		rr.Tools = append(rr.Tools, map[string]any{
+			"type":        "function",
+			"name":        tool.Function.Name,
+			"description": tool.Function.Description,
+			"parameters":  tool.Function.Parameters,
+			"strict":      false,
+		})
+	}
+	if format := wr.ResponseFormat; format != nil {
+		switch {
+		case format.Type == "json_object":
+			rr.Text = map[string]any{"format": map[string]any{"type": "json_object"}}
+		case format.Type == "json_schema" && format.JSONSchema != nil:
+			rr.Text = map[string]any{"format": map[string]any{
+				"type":   "json_schema",
+				"name":   format.JSONSchema.Name,
+				"schema": format.JSONSchema.Schema,
+				"strict": format.JSONSchema.Strict,
+			}}
+		}
+	}
+
+	var system []string
+	messages := wr.Messages
+	for _, m := range messages {
+		if m.Role == "system" || m.Role == "developer" {
+			system = append(system, m.text())
+		}
+	}
+	rr.Instructions = strings.Join(system, "\n")
+	if p.lastID != "" && len(messages) > p.lastLen && len(messages[p.lastLen-1].ToolCalls) == p.lastCalls {
+		rr.PreviousResponseID = p.lastID
+		messages = messages[p.lastLen:]
+	}
+	for _, m := range messages {
+		rr.Input = append(rr.Input, responsesInput(m)...)
+	}
+
+	body, err := json.Marshal(rr)
+	if err != nil {
+		return params, err
+	}
+	err = json.Unmarshal(body, &params)
+	return params, err
+}
+
+// responsesInput converts a chat message to the input items.
+func responsesInput(m wireMessage) []map[string]any {
+	var items []map[string]any
+	switch m.Role {
+	case "user":
+		var content []map[string]any
+		for _, part := range m.parts() {
+			switch part.Type {
+			case "text":
+				content = append(content, map[string]any{"type": "input_text", "text": part.Text})
+			case "image_url":
+				content = append(content, map[string]any{"type": "input_image", "image_url": part.ImageURL.URL, "detail": "auto"})
+			}
+		}
+		if len(content) > 0 {
+			items = append(items, map[string]any{"type": "message", "role": "user", "content": content})
+		}
+	case "assistant":
+		if text := m.text(); text != "" {
+			items = append(items, map[string]any{"type": "message", "role": "assistant", "content": text})
+		}
+		for _, call := range m.ToolCalls {
+			items = append(items, map[string]any{
+				"type":      "function_call",
+				"call_id":   call.ID,
+				"name":      call.Function.Name,
+				"arguments": call.Function.Arguments,
+			})
+		}
+	case "tool":
+		items = append(items, map[string]any{
+			"type":    "function_call_output",
+			"call_id": m.ToolCallID,
+			"output":  m.text(),
+		})
+	}
+	return items
+}
+
+// Stream implements the Provider interface.
+func (p *responsesProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	var round Round
+
+	params, err := p.buildRequest(req)
+	if err != nil {
+		return round, err
+	}
+	if body, err := json.Marshal(params); err == nil {
+		slog.Debug("Responses request", "body", string(body))
+	}
+
+	s := p.client.Responses.NewStreaming(ctx, params)
+	if s.Err() != nil {
+		return round, s.Err()
+	}
+	defer s.Close()
+
+	verbose := viper.GetInt("verbose")
+	var content strings.Builder
+	var completed responses.Response
+	for s.Next() {
+		event := s.Current()
+		if verbose >= 3 {
+			slog.Debug("stream chunk", "chunk", event.RawJSON())
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			w.Write([]byte(event.Delta))
+			content.WriteString(event.Delta)
+		case "response.reasoning_summary_text.delta":
+			showReasoning(event.Delta)
+		case "response.reasoning_summary_text.done":
+			fmt.Fprintln(os.Stderr)
+		case "response.output_item.done":
+			if event.Item.Type == "function_call" {
+				call := openai.ChatCompletionChunkChoiceDeltaToolCall{
+					Index: int64(len(round.ToolCalls)),
+					ID:    event.Item.CallID,
+					Type:  "function",
+				}
+				call.Function.Name = event.Item.Name
+				call.Function.Arguments = event.Item.Arguments
+				round.ToolCalls = append(round.ToolCalls, call)
+			}
+		case "response.completed", "response.incomplete":
+			completed = event.Response
+			if event.Type == "response.incomplete" {
+				slog.Warn("response is incomplete", "reason", completed.IncompleteDetails.Reason)
+			}
+		case "response.failed":
+			return round, errors.New(event.Response.Error.Message)
+		case "error":
+			return round, fmt.Errorf("%s: %s", event.Code, event.Message)
+		}
+	}
+	if s.Err() != nil {
+		return round, s.Err()
+	}
+
+	if completed.ID != "" {
+		p.lastID = completed.ID
+		// the answer will be appended as one assistant message
+		p.lastLen = len(req.Messages) + 1
+		p.lastCalls = len(round.ToolCalls)
+	}
+
+	usage := completed.Usage
+	round.Content = content.String()
+	round.Usage.PromptTokens = usage.InputTokens
+	round.Usage.PromptTokensDetails.CachedTokens = usage.InputTokensDetails.CachedTokens
+	round.Usage.CompletionTokens = usage.OutputTokens
+	round.Usage.CompletionTokensDetails.ReasoningTokens = usage.OutputTokensDetails.ReasoningTokens
+	round.Usage.TotalTokens = usage.TotalTokens
+	return round, nil
+}
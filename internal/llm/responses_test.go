@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// responsesStandIn is a local stand-in of the Responses API, it replies the events in order and records the requests.
+func responsesStandIn(t *testing.T, replies ...[]string) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			http.NotFound(w, r)
+			return
+		}
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		w.Header().Set("content-type", "text/event-stream")
+		for _, event := range replies[len(requests)-1] {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestResponsesChainsToolOutputs(t *testing.T) {
+	replies := [][]string{
+		{
+			`{"type":"response.reasoning_summary_text.delta","delta":"thinking"}`,
+			`{"type":"response.output_item.done","item":{"type":"function_call","call_id":"call_1","name":"add","arguments":"{\"a\":1}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15,"output_tokens_details":{"reasoning_tokens":3}}}}`,
+		},
+		{
+			`{"type":"response.output_text.delta","delta":"it is "}`,
+			`{"type":"response.output_text.delta","delta":"2"}`,
+			`{"type":"response.completed","response":{"id":"resp_2","usage":{"input_tokens":20,"output_tokens":2,"total_tokens":22}}}`,
+		},
+	}
+	server, recorded := responsesStandIn(t, replies...)
+
+	p := newResponsesProvider(&utils.LLM{Gateway: server.URL + "/v1/", ApiKey: "test-key", API: "responses"})
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage("be brief"),
+		openai.UserMessage("1+1?"),
+	}
+	req := openai.ChatCompletionNewParams{
+		Model:           "gpt-test",
+		Messages:        messages,
+		ReasoningEffort: shared.ReasoningEffort("low"),
+		Tools: []openai.ChatCompletionToolUnionParam{
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{Name: "add", Parameters: shared.FunctionParameters{"type": "object"}}),
+		},
+	}
+	round, err := p.Stream(context.Background(), req, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.ToolCalls) != 1 || round.ToolCalls[0].ID != "call_1" || round.Usage.CompletionTokensDetails.ReasoningTokens != 3 {
+		t.Fatalf("unexpected round %+v", round)
+	}
+	requests := *recorded
+	first := requests[0]
+	if first["instructions"] != "be brief" || MGet(first, "reasoning.summary", "") != "auto" || MGet(first, "tools.0.name", "") != "add" {
+		t.Fatalf("unexpected first request %v", first)
+	}
+	if len(first["input"].([]any)) != 1 {
+		t.Fatalf("system message should not be an input item: %v", first["input"])
+	}
+
+	req.Messages = append(messages,
+		openai.ChatCompletionMessageParamUnion{OfAssistant: &openai.ChatCompletionAssistantMessageParam{ToolCalls: []openai.ChatCompletionMessageToolCallUnionParam{{
+			OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{ID: "call_1", Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{Name: "add", Arguments: `{"a":1}`}},
+		}}}},
+		openai.ToolMessage("2", "call_1"),
+	)
+	var out bytes.Buffer
+	round, err = p.Stream(context.Background(), req, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "it is 2" || round.Usage.TotalTokens != 22 {
+		t.Fatalf("unexpected answer %q, %+v", out.String(), round.Usage)
+	}
+	second := (*recorded)[1]
+	if second["previous_response_id"] != "resp_1" {
+		t.Fatalf("request is not chained: %v", second)
+	}
+	input := second["input"].([]any)
+	if len(input) != 1 || MGet(input, "0.type", "") != "function_call_output" || MGet(input, "0.output", "") != "2" {
+		t.Fatalf("only the tool output should be sent: %v", input)
+	}
+}
+
+func TestResponsesSendsHistoryWhenCallsDropped(t *testing.T) {
+	server, requests := responsesStandIn(t,
+		[]string{
+			`{"type":"response.output_text.delta","delta":"let me check"}`,
+			`{"type":"response.output_item.done","item":{"type":"function_call","call_id":"call_1","name":"add","arguments":"{}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1"}}`,
+		},
+		[]string{
+			`{"type":"response.output_text.delta","delta":"2"}`,
+			`{"type":"response.completed","response":{"id":"resp_2"}}`,
+		},
+	)
+	p := newResponsesProvider(&utils.LLM{Gateway: server.URL + "/v1/", ApiKey: "test-key", API: "responses"})
+	req := openai.ChatCompletionNewParams{Model: "gpt-test", Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("1+1?")}}
+	if _, err := p.Stream(context.Background(), req, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tool rounds are used up, the calls are dropped and the model is asked for a final answer
+	req.Messages = append(req.Messages, openai.AssistantMessage("let me check"), openai.UserMessage("answer now"))
+	if _, err := p.Stream(context.Background(), req, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	second := (*requests)[1]
+	if _, ok := second["previous_response_id"]; ok {
+		t.Fatalf("the request without the call outputs is chained: %v", second)
+	}
+	if input := second["input"].([]any); len(input) != 3 {
+		t.Fatalf("expected the full history, got %v", input)
+	}
+}
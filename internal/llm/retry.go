@@ -0,0 +1,220 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elsejj/gpt/internal/usage"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+const (
+	// defaultRetries is used when the retries of a model is not set.
+	defaultRetries = 2
+	// maxBackoff limits the exponential backoff, and maxRetryAfter limits the delay asked by the server.
+	maxBackoff    = 30 * time.Second
+	maxRetryAfter = 5 * time.Minute
+)
+
+// candidate is a model of the fallback chain.
+type candidate struct {
+	conf     utils.LLM
+	provider Provider
+}
+
+// chainProvider sends the requests to the first model of a fallback chain.
+// Transient errors are retried with exponential backoff, when the retries are exhausted
+// the request is resumed on the next model, which is used for the rest of the chat.
+// A request is never retried once a part of the answer has been written.
+// The usage of each request is accumulated into the prompt and the ledger entries of the chat,
+// including the usage reported by a failed or retried request, as it's paid as well.
+type chainProvider struct {
+	chain  []candidate
+	active int
+	// sleep waits between the retries, it's replaced in tests.
+	sleep   func(ctx context.Context, d time.Duration) error
+	prompt  *utils.Prompt
+	entries []usage.Entry
+}
+
+// newChainProvider creates the provider of the current model and its fallbacks.
+func newChainProvider(conf *utils.AppConf) *chainProvider {
+	llms := append([]utils.LLM{conf.LLM}, conf.FallbackLLMs()...)
+	chain := make([]candidate, 0, len(llms))
+	for _, llm := range llms {
+		chain = append(chain, candidate{conf: llm, provider: NewProvider(&llm)})
+	}
+	return &chainProvider{chain: chain, sleep: sleepContext, prompt: conf.Prompt}
+}
+
+// Active returns the config of the model in use.
+func (p *chainProvider) Active() utils.LLM {
+	return p.chain[p.active].conf
+}
+
+// Stream implements the Provider interface.
+func (p *chainProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	cw := &countingWriter{w: w}
+	for {
+		c := p.chain[p.active]
+		if p.active > 0 {
+			// the effort of the first model is not sent to a fallback which does not set its own
+			req.Model = c.conf.Model
+			req.ReasoningEffort = shared.ReasoningEffort(c.conf.ReasonEffort)
+		}
+		round, err := p.streamWithRetry(ctx, c, req, cw)
+		if err == nil {
+			return round, nil
+		}
+		if cw.n > 0 || !isTransient(ctx, err) || p.active == len(p.chain)-1 {
+			return round, err
+		}
+		p.active++
+		slog.Warn("model failed, fall back to the next one", "model", c.conf.Model, "next", p.chain[p.active].conf.Model, "err", err)
+	}
+}
+
+// record accumulates the usage of a request, the entries are kept by model.
+func (p *chainProvider) record(llm utils.LLM, u openai.CompletionUsage) {
+	cost := llm.Pricing.Cost(u)
+	if p.prompt != nil {
+		p.prompt.Usage.PromptTokens += u.PromptTokens
+		p.prompt.Usage.CompletionTokens += u.CompletionTokens
+		p.prompt.Usage.TotalTokens += u.TotalTokens
+		p.prompt.Usage.PromptTokensDetails.CachedTokens += u.PromptTokensDetails.CachedTokens
+		p.prompt.Usage.CompletionTokensDetails.ReasoningTokens += u.CompletionTokensDetails.ReasoningTokens
+		p.prompt.Cost += cost
+	}
+
+	var entry *usage.Entry
+	for i := range p.entries {
+		if p.entries[i].Model == llm.Model && p.entries[i].Provider == llm.Provider {
+			entry = &p.entries[i]
+		}
+	}
+	if entry == nil {
+		p.entries = append(p.entries, usage.Entry{Provider: llm.Provider, Model: llm.Model})
+		entry = &p.entries[len(p.entries)-1]
+	}
+	entry.PromptTokens += u.PromptTokens
+	entry.CompletionTokens += u.CompletionTokens
+	entry.CachedTokens += u.PromptTokensDetails.CachedTokens
+	entry.ReasoningTokens += u.CompletionTokensDetails.ReasoningTokens
+	entry.Cost += cost
+}
+
+// streamWithRetry sends the request to a model, transient errors are retried until the retries of the model are exhausted.
+// The usage of every attempt is recorded.
+func (p *chainProvider) streamWithRetry(ctx context.Context, c candidate, req openai.ChatCompletionNewParams, cw *countingWriter) (Round, error) {
+	retries := c.conf.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+	for attempt := 0; ; attempt++ {
+		round, err := c.provider.Stream(ctx, req, cw)
+		if err == nil || round.Usage.PromptTokens+round.Usage.CompletionTokens > 0 {
+			p.record(c.conf, round.Usage)
+		}
+		if err == nil || cw.n > 0 || !isTransient(ctx, err) || attempt >= retries {
+			return round, err
+		}
+		delay := retryDelay(attempt, err)
+		slog.Warn("request failed, retry", "model", c.conf.Model, "attempt", attempt+1, "delay", delay, "err", err)
+		if err := p.sleep(ctx, delay); err != nil {
+			return round, err
+		}
+	}
+}
+
+// countingWriter counts the bytes written, a request which has written is not retried.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// isTransient reports whether err is worth retrying: a 408, 409, 429 or 5xx status, or a network error.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if status, _ := errorStatus(err); status != 0 {
+		return status == http.StatusRequestTimeout || status == http.StatusConflict ||
+			status == http.StatusTooManyRequests || status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// errorStatus returns the http status and headers of an error responded by the server.
+func errorStatus(err error) (int, http.Header) {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.StatusCode, se.Header
+	}
+	var oe *openai.Error
+	if errors.As(err, &oe) {
+		var header http.Header
+		if oe.Response != nil {
+			header = oe.Response.Header
+		}
+		return oe.StatusCode, header
+	}
+	return 0, nil
+}
+
+// retryDelay returns the delay before the next attempt, the Retry-After of the server is honored.
+func retryDelay(attempt int, err error) time.Duration {
+	if _, header := errorStatus(err); header != nil {
+		if d, ok := parseRetryAfter(header, time.Now()); ok {
+			return min(d, maxRetryAfter)
+		}
+	}
+	backoff := min(time.Second<<min(attempt, 10), maxBackoff)
+	// add a jitter, so the clients do not retry at the same time
+	return backoff + rand.N(backoff/2+1)
+}
+
+// parseRetryAfter reads the retry-after-ms and Retry-After headers, the later can be seconds or a http date.
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d, it returns early when ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
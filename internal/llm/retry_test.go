@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+// flakyProvider fails with the errors in order, then answers text. Each request reports usage, the failed ones too.
+type flakyProvider struct {
+	errs     []error
+	partial  string
+	text     string
+	usage    openai.CompletionUsage
+	requests []openai.ChatCompletionNewParams
+}
+
+func (p *flakyProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	p.requests = append(p.requests, req)
+	if len(p.requests) <= len(p.errs) {
+		io.WriteString(w, p.partial)
+		return Round{Usage: p.usage}, p.errs[len(p.requests)-1]
+	}
+	io.WriteString(w, p.text)
+	return Round{Content: p.text, Usage: p.usage}, nil
+}
+
+func newTestChain(sleeps *[]time.Duration, candidates ...candidate) *chainProvider {
+	return &chainProvider{
+		chain: candidates,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			*sleeps = append(*sleeps, d)
+			return nil
+		},
+	}
+}
+
+func TestChainRetriesWithRetryAfter(t *testing.T) {
+	limited := &statusError{StatusCode: 429, Header: http.Header{"Retry-After": {"7"}}}
+	p := &flakyProvider{errs: []error{limited, &statusError{StatusCode: 503}}, text: "ok"}
+	var sleeps []time.Duration
+	chain := newTestChain(&sleeps, candidate{conf: utils.LLM{Model: "a"}, provider: p})
+
+	var out strings.Builder
+	round, err := chain.Stream(context.Background(), openai.ChatCompletionNewParams{Model: "a"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.Content != "ok" || out.String() != "ok" {
+		t.Fatalf("unexpected answer %q, output %q", round.Content, out.String())
+	}
+	if len(sleeps) != 2 || sleeps[0] != 7*time.Second {
+		t.Fatalf("unexpected delays %v", sleeps)
+	}
+	if sleeps[1] < 2*time.Second || sleeps[1] > 3*time.Second {
+		t.Fatalf("the second delay is not backed off: %v", sleeps[1])
+	}
+}
+
+func TestChainFallsBackAfterRetries(t *testing.T) {
+	down := &statusError{StatusCode: 502}
+	first := &flakyProvider{errs: []error{down, down}}
+	second := &flakyProvider{text: "from b"}
+	var sleeps []time.Duration
+	chain := newTestChain(&sleeps,
+		candidate{conf: utils.LLM{Model: "a", Retries: 1}, provider: first},
+		candidate{conf: utils.LLM{Model: "b"}, provider: second},
+	)
+
+	req := openai.ChatCompletionNewParams{
+		Model:           "a",
+		ReasoningEffort: "high",
+		Messages:        []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	}
+	round, err := chain.Stream(context.Background(), req, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.Content != "from b" || len(first.requests) != 2 {
+		t.Fatalf("unexpected answer %q after %d requests", round.Content, len(first.requests))
+	}
+	if got := second.requests[0]; got.Model != "b" || len(got.Messages) != 1 || got.ReasoningEffort != "" {
+		t.Fatalf("the fallback does not resume the messages: %+v", got)
+	}
+
+	// the fallback is kept for the next rounds
+	if _, err := chain.Stream(context.Background(), req, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.requests) != 2 || len(second.requests) != 2 || chain.Active().Model != "b" {
+		t.Fatalf("the fallback is not kept, active %s", chain.Active().Model)
+	}
+}
+
+func TestChainRecordsUsageOfFailedAttempts(t *testing.T) {
+	usage := openai.CompletionUsage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110}
+	first := &flakyProvider{errs: []error{&statusError{StatusCode: 502}, &statusError{StatusCode: 502}}, usage: usage}
+	second := &flakyProvider{text: "ok", usage: usage}
+	var sleeps []time.Duration
+	chain := newTestChain(&sleeps,
+		candidate{conf: utils.LLM{Model: "a", Retries: 1}, provider: first},
+		candidate{conf: utils.LLM{Model: "b"}, provider: second},
+	)
+	chain.prompt = &utils.Prompt{}
+
+	if _, err := chain.Stream(context.Background(), openai.ChatCompletionNewParams{Model: "a"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if chain.prompt.Usage.TotalTokens != 330 {
+		t.Fatalf("expected the usage of all attempts, got %d tokens", chain.prompt.Usage.TotalTokens)
+	}
+	if len(chain.entries) != 2 || chain.entries[0].PromptTokens != 200 || chain.entries[1].PromptTokens != 100 {
+		t.Fatalf("unexpected ledger entries %+v", chain.entries)
+	}
+}
+
+func TestChainDoesNotRetryAfterOutput(t *testing.T) {
+	p := &flakyProvider{errs: []error{&statusError{StatusCode: 500}}, partial: "half", text: "again"}
+	var sleeps []time.Duration
+	chain := newTestChain(&sleeps,
+		candidate{conf: utils.LLM{Model: "a"}, provider: p},
+		candidate{conf: utils.LLM{Model: "b"}, provider: &flakyProvider{text: "b"}},
+	)
+
+	_, err := chain.Stream(context.Background(), openai.ChatCompletionNewParams{}, io.Discard)
+	var se *statusError
+	if !errors.As(err, &se) || len(p.requests) != 1 || chain.Active().Model != "a" {
+		t.Fatalf("expected the error without retry, got %v after %d requests", err, len(p.requests))
+	}
+}
+
+func TestChainDoesNotRetryClientErrors(t *testing.T) {
+	p := &flakyProvider{errs: []error{&statusError{StatusCode: 400}}, text: "ok"}
+	var sleeps []time.Duration
+	chain := newTestChain(&sleeps, candidate{conf: utils.LLM{Model: "a"}, provider: p})
+
+	if _, err := chain.Stream(context.Background(), openai.ChatCompletionNewParams{}, io.Discard); err == nil {
+		t.Fatal("expected the error")
+	}
+	if len(p.requests) != 1 || len(sleeps) != 0 {
+		t.Fatalf("a bad request is retried %d times", len(p.requests)-1)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second, true},
+		{http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, 90 * time.Second, true},
+		{http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"3"}}, 250 * time.Millisecond, true},
+		{http.Header{"Retry-After": {"soon"}}, 0, false},
+		{http.Header{}, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := parseRetryAfter(c.header, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("parseRetryAfter(%v) = %v, %v, want %v, %v", c.header, got, ok, c.want, c.ok)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go/v3"
+)
+
+// ErrSamplingDenied is returned to a server when the user denies its sampling request.
+var ErrSamplingDenied = errors.New("the user denied the sampling request")
+
+// Sampler answers the sampling requests of the mcp servers with the models of conf, it implements mcps.Sampler.
+// The model of a request is the first alias of LLMs matching the model hints of the server, or the current model.
+type Sampler struct {
+	conf *utils.AppConf
+	// MaxTokens caps the total tokens of all the sampling requests, zero means no limit.
+	MaxTokens int64
+	// Approve is asked with the name of the server and the text of its request before it's sent to the model,
+	// nil approves all the requests.
+	Approve func(server string, request string) (bool, error)
+
+	mu   sync.Mutex
+	used int64
+}
+
+// NewSampler creates a sampler with the models of conf, the current model is read when a request comes.
+func NewSampler(conf *utils.AppConf) *Sampler {
+	return &Sampler{conf: conf}
+}
+
+// Sample answers a sampling request of a server.
+func (s *Sampler) Sample(ctx context.Context, server string, req mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	remaining, err := s.remaining()
+	if err != nil {
+		return nil, err
+	}
+	messages, err := samplingMessages(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+	if s.Approve != nil {
+		approved, err := s.Approve(server, samplingText(req))
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			return nil, ErrSamplingDenied
+		}
+	}
+
+	conf := s.samplingConf(req.ModelPreferences)
+	params := openai.ChatCompletionNewParams{
+		Messages: withSystemMessage(messages, req.SystemPrompt),
+	}
+	if req.Temperature > 0 {
+		params.Temperature = openai.Float(req.Temperature)
+	}
+	maxTokens := int64(req.MaxTokens)
+	if remaining > 0 && (maxTokens <= 0 || maxTokens > remaining) {
+		maxTokens = remaining
+	}
+	if maxTokens > 0 {
+		params.MaxCompletionTokens = openai.Int(maxTokens)
+	}
+	if len(req.StopSequences) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: req.StopSequences}
+	}
+
+	slog.Info("mcp sampling", "server", server, "model", conf.LLM.Model, "maxTokens", maxTokens)
+	round, err := Complete(ctx, conf, params, io.Discard)
+	s.mu.Lock()
+	s.used += round.Usage.TotalTokens
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{
+			Role:    mcp.RoleAssistant,
+			Content: mcp.NewTextContent(round.Content),
+		},
+		Model:      conf.LLM.Model,
+		StopReason: "endTurn",
+	}, nil
+}
+
+// remaining returns the tokens left for sampling, zero means no limit.
+func (s *Sampler) remaining() (int64, error) {
+	if s.MaxTokens <= 0 {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used >= s.MaxTokens {
+		return 0, fmt.Errorf("%w: %d tokens used by sampling, the limit is %d", ErrBudgetExceeded, s.used, s.MaxTokens)
+	}
+	return s.MaxTokens - s.used, nil
+}
+
+// samplingConf returns the conf of the model for a sampling request, the first hint which is a part of the name
+// or the model of an alias of LLMs selects it, otherwise the current model is used.
+func (s *Sampler) samplingConf(preferences *mcp.ModelPreferences) *utils.AppConf {
+	conf := *s.conf
+	conf.Prompt = &utils.Prompt{Tool: "sampling", Temperature: 1}
+	if preferences == nil {
+		return &conf
+	}
+	aliases := slices.Sorted(maps.Keys(conf.LLMs))
+	for _, hint := range preferences.Hints {
+		name := strings.ToLower(hint.Name)
+		if name == "" {
+			continue
+		}
+		for _, alias := range aliases {
+			if strings.Contains(strings.ToLower(alias), name) || strings.Contains(strings.ToLower(conf.LLMs[alias].Model), name) {
+				conf.Prompt.OverrideModel = alias
+				conf.PickupModel()
+				return &conf
+			}
+		}
+	}
+	return &conf
+}
+
+// samplingMessages converts the messages of a sampling request, the images are accepted from the user only.
+func samplingMessages(messages []mcp.SamplingMessage) ([]openai.ChatCompletionMessageParamUnion, error) {
+	converted := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
+	for _, message := range messages {
+		switch content := message.Content.(type) {
+		case mcp.TextContent:
+			if message.Role == mcp.RoleAssistant {
+				converted = append(converted, openai.AssistantMessage(content.Text))
+			} else {
+				converted = append(converted, openai.UserMessage(content.Text))
+			}
+		case mcp.ImageContent:
+			if message.Role == mcp.RoleAssistant {
+				return nil, errors.New("an image of the assistant is not supported")
+			}
+			converted = append(converted, openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
+				openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+					URL: "data:" + content.MIMEType + ";base64," + content.Data,
+				}),
+			}))
+		default:
+			return nil, fmt.Errorf("sampling content %T is not supported", message.Content)
+		}
+	}
+	return converted, nil
+}
+
+// samplingText is the text of a sampling request shown to the user for approval.
+func samplingText(req mcp.CreateMessageRequest) string {
+	var b strings.Builder
+	if req.SystemPrompt != "" {
+		fmt.Fprintf(&b, "system: %s\n", req.SystemPrompt)
+	}
+	for _, message := range req.Messages {
+		switch content := message.Content.(type) {
+		case mcp.TextContent:
+			fmt.Fprintf(&b, "%s: %s\n", message.Role, content.Text)
+		case mcp.ImageContent:
+			fmt.Fprintf(&b, "%s: [image %s]\n", message.Role, content.MIMEType)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestSamplerAnswersWithHintedModel(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var sent struct {
+			Model    string           `json:"model"`
+			Messages []map[string]any `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		models = append(models, sent.Model)
+		if len(sent.Messages) != 2 || sent.Messages[0]["role"] != "system" {
+			t.Errorf("unexpected messages %v", sent.Messages)
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"a summary"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":12,"eval_count":7}`)
+	}))
+	defer server.Close()
+
+	conf := &utils.AppConf{
+		LLM: utils.LLM{Provider: "ollama", Gateway: server.URL, Model: "llama3", Retries: -1},
+		LLMs: map[string]utils.LLM{
+			"small": {Provider: "ollama", Gateway: server.URL, Model: "qwen3:8b", Retries: -1},
+		},
+	}
+	sampler := NewSampler(conf)
+	sampler.MaxTokens = 20
+	var asked []string
+	sampler.Approve = func(server string, request string) (bool, error) {
+		asked = append(asked, server+"> "+request)
+		return len(asked) < 3, nil
+	}
+
+	req := mcp.CreateMessageRequest{}
+	req.SystemPrompt = "be brief"
+	req.Messages = []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent("summarize it")}}
+	req.ModelPreferences = &mcp.ModelPreferences{Hints: []mcp.ModelHint{{Name: "claude"}, {Name: "qwen"}}}
+	result, err := sampler.Sample(context.Background(), "docs", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, ok := result.Content.(mcp.TextContent)
+	if !ok || text.Text != "a summary" || result.Model != "qwen3:8b" || result.Role != mcp.RoleAssistant {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if asked[0] != "docs> system: be brief\nuser: summarize it" {
+		t.Fatalf("unexpected approval %q", asked[0])
+	}
+
+	// no hint matches, the current model is used
+	req.ModelPreferences = nil
+	if _, err := sampler.Sample(context.Background(), "docs", req); err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0] != "qwen3:8b" || models[1] != "llama3" {
+		t.Fatalf("unexpected models %v", models)
+	}
+
+	// 38 tokens are used, the cap is exceeded
+	if _, err := sampler.Sample(context.Background(), "docs", req); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected budget exceeded, got %v", err)
+	}
+	sampler.MaxTokens = 0
+	if _, err := sampler.Sample(context.Background(), "docs", req); !errors.Is(err, ErrSamplingDenied) {
+		t.Fatalf("expected the request denied, got %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("expected no request to the model, got %v", models)
+	}
+}
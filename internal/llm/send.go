@@ -4,59 +4,42 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/elsejj/gpt/internal/usage"
 	"github.com/elsejj/gpt/internal/utils"
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/shared"
-	"github.com/spf13/viper"
 )
 
-func debugChunk(c string) {
-	var verbose = viper.GetInt("verbose")
-	if verbose >= 3 {
-		// detailed debug info
-		slog.Debug("stream chunk", "chunk", c)
-	} else if verbose >= 2 {
-		// only log reason content
-		var chunk map[string]any
-		err := json.Unmarshal([]byte(c), &chunk)
-		if err != nil {
-			slog.Debug("stream chunk", "chunk", c)
-			return
-		}
-		reasonContent := MGet(chunk, "choices.0.delta.reasoning_content", "")
-		if len(reasonContent) > 0 {
-			fmt.Printf("\033[37m%s\033[0m", reasonContent)
-		}
-	}
-
-}
-
 // Chat sends the user's prompt to the LLM and writes the response to the provided writer.
-// It also handles tool calls and image data.
-func Chat(conf *utils.AppConf, w io.Writer) error {
+// It also handles tool calls and image data, the chat is aborted when ctx is done or Prompt.Timeout is exceeded.
+func Chat(ctx context.Context, conf *utils.AppConf, w io.Writer) error {
 	if conf == nil || conf.Prompt == nil {
 		return fmt.Errorf("config or prompt is nil")
 	}
 
-	client := openai.NewClient(
-		option.WithAPIKey(conf.LLM.ApiKey),
-		option.WithBaseURL(conf.LLM.Gateway),
-		option.WithHeaderAdd("x-portkey-provider", conf.LLM.Provider),
-	)
+	provider := newChainProvider(conf)
+	// the usage is recorded even the chat fails, it's paid anyway
+	defer func() {
+		recordUsage(provider.entries, conf.Prompt.Tool)
+	}()
+	if conf.Prompt.MaxCost > 0 && conf.LLM.Pricing == nil {
+		slog.Warn("the cost is unknown without the pricing of the model, the max cost is not checked", "model", conf.LLM.Model)
+	}
 
-	ctx := context.Background()
-	var messages []openai.ChatCompletionMessageParamUnion
-	if conf.Prompt.System != "" {
-		messages = append(messages, openai.SystemMessage(conf.Prompt.System))
+	if conf.Prompt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Prompt.Timeout)
+		defer cancel()
 	}
+	messages := withSystemMessage(conf.Prompt.History, conf.Prompt.System)
 	if len(conf.Prompt.Images) == 0 {
 		messages = append(messages, openai.UserMessage(conf.Prompt.User))
 	} else {
@@ -74,21 +57,151 @@ func Chat(conf *utils.AppConf, w io.Writer) error {
 		messages = append(messages, openai.UserMessage(parts))
 	}
 
-	messages, usage, err := llmToolCall(ctx, &client, messages, conf, w)
+	out := w
+	var buf *bytes.Buffer
+	if conf.Prompt.Schema != nil {
+		// the output is written after it's validated
+		buf = bytes.NewBuffer(nil)
+		out = buf
+	}
+
+	messages, usage, err := llmToolCall(ctx, provider, messages, conf, out)
 	if err != nil {
-		return err
+		return chatError(ctx, err)
+	}
+
+	if conf.Prompt.Schema != nil {
+		var retryUsage openai.CompletionUsage
+		messages, retryUsage, err = conformSchema(ctx, provider, messages, conf, buf)
+		usage.PromptTokens += retryUsage.PromptTokens
+		usage.CompletionTokens += retryUsage.CompletionTokens
+		usage.TotalTokens += retryUsage.TotalTokens
+		if err != nil {
+			return chatError(ctx, err)
+		}
+		w.Write(buf.Bytes())
 	}
 
 	//w.Write([]byte("\n"))
 
 	slog.Debug("allMessages", "messages", messages)
+	conf.Prompt.History = messages
 
 	if conf.Prompt.WithUsage {
-		slog.Info("Usage", "prompt", usage.PromptTokens, "completion", usage.CompletionTokens, "provider", conf.LLM.Provider, "model", conf.LLM.Model)
+		active := provider.Active()
+		slog.Info("Usage", "prompt", usage.PromptTokens, "completion", usage.CompletionTokens, "cost", chatCost(provider.entries), "provider", active.Provider, "model", active.Model, "toolFailures", conf.Prompt.ToolFailures)
 	}
 	return nil
 }
 
+// ErrBudgetExceeded is returned when the accumulated cost or tokens of the prompt exceed its limit.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// DefaultMaxToolRounds and DefaultMaxToolFailures limit the tool calling loop of a request, see Complete.
+const (
+	DefaultMaxToolRounds   = 20
+	DefaultMaxToolFailures = 3
+)
+
+// ErrMaxToolRounds is returned when the model still calls tools after Prompt.MaxToolRounds rounds of tool calls,
+// and the tools are disabled for a final answer.
+var ErrMaxToolRounds = errors.New("too many tool rounds")
+
+// ErrToolFailures is returned when a tool still fails after Prompt.MaxToolFailures consecutive calls.
+var ErrToolFailures = errors.New("too many tool failures")
+
+// checkBudget returns ErrBudgetExceeded when the prompt exceeds MaxCost or MaxTokens.
+func checkBudget(prompt *utils.Prompt) error {
+	if prompt.MaxTokens > 0 && prompt.Usage.TotalTokens > prompt.MaxTokens {
+		return fmt.Errorf("%w: %d tokens used, the limit is %d", ErrBudgetExceeded, prompt.Usage.TotalTokens, prompt.MaxTokens)
+	}
+	if prompt.MaxCost > 0 && prompt.Cost > prompt.MaxCost {
+		return fmt.Errorf("%w: $%.4f spent, the limit is $%.4f", ErrBudgetExceeded, prompt.Cost, prompt.MaxCost)
+	}
+	return nil
+}
+
+// chatCost sums the cost of the ledger entries of a chat.
+func chatCost(entries []usage.Entry) float64 {
+	cost := 0.0
+	for _, entry := range entries {
+		cost += entry.Cost
+	}
+	return cost
+}
+
+// recordUsage appends the usage of a chat to the ledger.
+func recordUsage(entries []usage.Entry, tool string) {
+	now := time.Now()
+	for i := range entries {
+		entries[i].Time = now
+		entries[i].Tool = tool
+	}
+	if err := usage.Append(entries...); err != nil {
+		slog.Warn("failed to record usage", "err", err)
+	}
+}
+
+// chatError explains an error caused by the timeout of the chat, the wrapped error is kept for errors.Is.
+func chatError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("chat timed out: %w", err)
+	}
+	return err
+}
+
+// schemaRetryPrompt asks the model to correct an output which does not match the schema.
+const schemaRetryPrompt = `Your answer does not match the required JSON schema:
+%v
+
+Answer again with only the corrected JSON.`
+
+// conformSchema validates the last answer against the schema of the prompt.
+// When it does not match, the model is asked once to correct it with the validation errors, buf holds the output of the last answer.
+func conformSchema(ctx context.Context, provider Provider, messages []openai.ChatCompletionMessageParamUnion, conf *utils.AppConf, buf *bytes.Buffer) ([]openai.ChatCompletionMessageParamUnion, openai.CompletionUsage, error) {
+	var usage openai.CompletionUsage
+	err := conf.Prompt.Schema.Validate(ExtractCodeBlock([]byte(lastAnswer(messages))))
+	if err == nil {
+		return messages, usage, nil
+	}
+	slog.Warn("output does not match the schema, retry", "err", err)
+
+	messages = append(messages, openai.UserMessage(fmt.Sprintf(schemaRetryPrompt, err)))
+	buf.Reset()
+	messages, usage, err = llmToolCall(ctx, provider, messages, conf, buf)
+	if err != nil {
+		return messages, usage, err
+	}
+	if err := conf.Prompt.Schema.Validate(ExtractCodeBlock([]byte(lastAnswer(messages)))); err != nil {
+		return messages, usage, fmt.Errorf("output does not match the schema: %w", err)
+	}
+	return messages, usage, nil
+}
+
+// lastAnswer returns the text of the last assistant message.
+func lastAnswer(messages []openai.ChatCompletionMessageParamUnion) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if assistant := messages[i].OfAssistant; assistant != nil {
+			return assistant.Content.OfString.Value
+		}
+	}
+	return ""
+}
+
+// withSystemMessage returns a copy of history that starts with the system prompt.
+// An existing system message is replaced, so a resumed conversation can change it.
+func withSystemMessage(history []openai.ChatCompletionMessageParamUnion, system string) []openai.ChatCompletionMessageParamUnion {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(history)+2)
+	if system == "" {
+		return append(messages, history...)
+	}
+	messages = append(messages, openai.SystemMessage(system))
+	if len(history) > 0 && history[0].OfSystem != nil {
+		history = history[1:]
+	}
+	return append(messages, history...)
+}
+
 // DataURLOfImageFile reads an image file and returns a data URL.
 func DataURLOfImageFile(filePath string) string {
 	body, err := os.ReadFile(filePath)
@@ -125,88 +238,123 @@ func ExtractCodeBlock(text []byte) []byte {
 // llmToolCall handles the tool calling logic.
 // It sends the request to the LLM, and if the LLM returns a tool call, it executes the tool and sends the result back to the LLM.
 // It returns the final messages, the total usage, and any error that occurred.
-func llmToolCall(ctx context.Context, client *openai.Client, messages []openai.ChatCompletionMessageParamUnion, conf *utils.AppConf, w io.Writer) ([]openai.ChatCompletionMessageParamUnion, openai.CompletionUsage, error) {
-	var totalUsage openai.CompletionUsage
-	for {
+func llmToolCall(ctx context.Context, provider Provider, messages []openai.ChatCompletionMessageParamUnion, conf *utils.AppConf, w io.Writer) ([]openai.ChatCompletionMessageParamUnion, openai.CompletionUsage, error) {
+	return toolLoop(ctx, provider, chatRequest(conf), messages, conf, w, "\n")
+}
 
-		// let model to think whether to call tool
-		req := openai.ChatCompletionNewParams{
-			Model:    conf.LLM.Model,
-			Messages: messages,
-		}
-		if conf.LLM.ReasonEffort != "" {
-			req.ReasoningEffort = shared.ReasoningEffort(conf.LLM.ReasonEffort)
+// chatRequest builds the request of the prompt without the messages.
+func chatRequest(conf *utils.AppConf) openai.ChatCompletionNewParams {
+	req := openai.ChatCompletionNewParams{
+		Model: conf.LLM.Model,
+	}
+	if conf.LLM.ReasonEffort != "" {
+		req.ReasoningEffort = shared.ReasoningEffort(conf.LLM.ReasonEffort)
+	}
+	if conf.Prompt.MCPServers != nil && len(conf.Prompt.MCPServers.OpenAITools()) > 0 {
+		req.Tools = conf.Prompt.MCPServers.OpenAITools()
+		req.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{}
+	}
+
+	// the usage is always needed for the cost and the ledger
+	req.StreamOptions = openai.ChatCompletionStreamOptionsParam{
+		IncludeUsage: openai.Bool(true),
+	}
+
+	if conf.Prompt.Schema != nil {
+		req.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   conf.Prompt.Schema.Name,
+					Schema: conf.Prompt.Schema.Definition,
+					Strict: openai.Bool(true),
+				},
+			},
 		}
-		if conf.Prompt.MCPServers != nil && len(conf.Prompt.MCPServers.Tools) > 0 {
-			req.Tools = conf.Prompt.MCPServers.Tools
-			req.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{}
+	} else if conf.Prompt.JsonMode {
+		req.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &openai.ResponseFormatJSONObjectParam{
+				Type: "json_object",
+			},
 		}
+	}
 
-		if conf.Prompt.WithUsage {
-			req.StreamOptions = openai.ChatCompletionStreamOptionsParam{
-				IncludeUsage: openai.Bool(true),
-			}
+	req.Temperature = openai.Float(conf.Prompt.Temperature)
+	return req
+}
+
+// toolLoop sends the messages with the base request, the tool calls of the model are executed by the MCP servers
+// of the prompt and their results are sent back, until the model answers without tool calls.
+// After Prompt.MaxToolRounds rounds, the tools are disabled and the model is asked for a final answer with the results so far.
+// The tools of the request are rebuilt before a round when a server notified its tools changed.
+// sep is written to w between the answers of the rounds, it's empty when w streams the content to a client.
+func toolLoop(ctx context.Context, provider Provider, base openai.ChatCompletionNewParams, messages []openai.ChatCompletionMessageParamUnion, conf *utils.AppConf, w io.Writer, sep string) ([]openai.ChatCompletionMessageParamUnion, openai.CompletionUsage, error) {
+	var totalUsage openai.CompletionUsage
+	toolRounds := 0
+	final := false
+	// failures counts the consecutive failed calls of each tool
+	failures := make(map[string]int)
+	for {
+		if err := checkBudget(conf.Prompt); err != nil {
+			return messages, totalUsage, err
 		}
 
-		if conf.Prompt.JsonMode {
-			req.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
-				OfJSONObject: &openai.ResponseFormatJSONObjectParam{
-					Type: "json_object",
-				},
-			}
+		if servers := conf.Prompt.MCPServers; servers != nil && servers.Refresh(ctx) {
+			base.Tools = servers.OpenAITools()
 		}
 
-		req.Temperature = openai.Float(conf.Prompt.Temperature)
+		// let model to think whether to call tool
+		req := base
+		req.Messages = messages
 
 		body, _ := req.MarshalJSON()
 		slog.Debug("Request", "body", string(body))
 
-		s := client.Chat.Completions.NewStreaming(ctx, req)
-		if s.Err() != nil {
-			return messages, totalUsage, s.Err()
-		}
-
-		var usage openai.CompletionUsage
-		toolCalls := make(map[int64]*openai.ChatCompletionChunkChoiceDeltaToolCall)
-		for s.Next() {
-			cur := s.Current()
-			debugChunk(cur.RawJSON())
-			for _, c := range cur.Choices {
-				w.Write([]byte(c.Delta.Content))
-				for _, toolCall := range c.Delta.ToolCalls {
-					tc, ok := toolCalls[c.Index]
-					if !ok {
-						tc = &toolCall
-						toolCalls[c.Index] = tc
-					} else {
-						tc.Function.Arguments += toolCall.Function.Arguments
-					}
-				}
-			}
-			usage = cur.Usage
+		round, err := provider.Stream(ctx, req, w)
+		if err != nil {
+			return messages, totalUsage, err
 		}
-		s.Close()
 
+		usage := round.Usage
 		totalUsage.PromptTokens += usage.PromptTokens
 		totalUsage.CompletionTokens += usage.CompletionTokens
 		totalUsage.TotalTokens += usage.TotalTokens
 
 		// there are no tool calls
-		if len(toolCalls) == 0 {
+		if len(round.ToolCalls) == 0 {
 			slog.Debug("no tool call required")
+			messages = append(messages, openai.AssistantMessage(round.Content))
 			break
 		}
 
-		w.Write([]byte("\n"))
-		toolCallMessages := make([]openai.ChatCompletionMessageParamUnion, 0)
-		assistantToolCalls := make([]openai.ChatCompletionMessageToolCallUnionParam, 0)
-		for _, toolCall := range toolCalls {
-			slog.Info("Model call ", "tool", toolCall.Function.Name, "args", toolCall.Function.Arguments)
-			toolResult, err := conf.Prompt.MCPServers.CallToolOpenAI(ctx, *toolCall)
-			if err != nil {
-				slog.Error("Error calling tool", "tool", toolCall.Function.Name)
-				return messages, totalUsage, err
+		// the tools are not called when there is no budget for their results
+		if err := checkBudget(conf.Prompt); err != nil {
+			return messages, totalUsage, err
+		}
+
+		if conf.Prompt.MaxToolRounds > 0 && toolRounds >= conf.Prompt.MaxToolRounds {
+			if round.Content != "" {
+				messages = append(messages, openai.AssistantMessage(round.Content))
+			}
+			if final {
+				return messages, totalUsage, fmt.Errorf("%w: the model still calls tools after %d rounds of tool calls, raise --max-tool-rounds to allow more", ErrMaxToolRounds, toolRounds)
 			}
+			// the calls are not run, the tools are disabled so the answer is not lost
+			slog.Warn("too many tool rounds, the tools are disabled for a final answer", "rounds", toolRounds)
+			final = true
+			base.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String("none")}
+			messages = append(messages, openai.UserMessage(fmt.Sprintf("The limit of %d rounds of tool calls is reached, the tools cannot be called anymore. Answer with the results so far.", toolRounds)))
+			io.WriteString(w, sep)
+			continue
+		}
+		toolRounds++
+
+		io.WriteString(w, sep)
+		toolCallMessages, err := callTools(ctx, conf, round.ToolCalls, failures, activeNoImages(provider, conf))
+		if err != nil {
+			return messages, totalUsage, err
+		}
+		assistantToolCalls := make([]openai.ChatCompletionMessageToolCallUnionParam, 0)
+		for _, toolCall := range round.ToolCalls {
 			assistantToolCalls = append(assistantToolCalls, openai.ChatCompletionMessageToolCallUnionParam{
 				OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
 					ID: toolCall.ID,
@@ -217,13 +365,13 @@ func llmToolCall(ctx context.Context, client *openai.Client, messages []openai.C
 					Type: "function",
 				},
 			})
-			toolCallMessages = append(toolCallMessages, toolResult)
-			slog.Info("Model call result ", "tool", toolCall.Function.Name, "result", toolResult)
-
 		}
 		assistantMessage := openai.ChatCompletionAssistantMessageParam{
 			ToolCalls: assistantToolCalls,
 		}
+		if round.Content != "" {
+			assistantMessage.Content.OfString = openai.String(round.Content)
+		}
 
 		// there are tool results
 		messages = append(messages, openai.ChatCompletionMessageParamUnion{OfAssistant: &assistantMessage})
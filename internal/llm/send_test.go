@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elsejj/gpt/internal/schema"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+// fakeProvider replies the rounds in order and records the requests.
+type fakeProvider struct {
+	rounds   []Round
+	requests []openai.ChatCompletionNewParams
+}
+
+func (p *fakeProvider) Stream(ctx context.Context, req openai.ChatCompletionNewParams, w io.Writer) (Round, error) {
+	p.requests = append(p.requests, req)
+	round := p.rounds[min(len(p.requests), len(p.rounds))-1]
+	io.WriteString(w, round.Content)
+	return round, nil
+}
+
+func newSchemaConf(t *testing.T) *utils.AppConf {
+	t.Helper()
+	s, err := schema.Load(`{"type":"object","properties":{"n":{"type":"integer"}},"required":["n"],"additionalProperties":false}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &utils.AppConf{
+		LLM:    utils.LLM{Model: "test"},
+		Prompt: &utils.Prompt{Schema: s},
+	}
+}
+
+func TestConformSchemaRetriesOnce(t *testing.T) {
+	conf := newSchemaConf(t)
+	provider := &fakeProvider{rounds: []Round{{Content: `{"n":1}`}}}
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.UserMessage("count"),
+		openai.AssistantMessage(`{"n":"one"}`),
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"n":"one"}`)
+
+	messages, _, err := conformSchema(context.Background(), provider, messages, conf, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"n":1}` {
+		t.Fatalf("expected the corrected output, got %q", buf.String())
+	}
+	if len(provider.requests) != 1 {
+		t.Fatalf("expected one retry, got %d", len(provider.requests))
+	}
+	retry := provider.requests[0].Messages[2].OfUser
+	if retry == nil || !strings.Contains(retry.Content.OfString.Value, "does not match") {
+		t.Fatalf("expected validation errors sent to the model, got %+v", provider.requests[0].Messages[2])
+	}
+	if provider.requests[0].ResponseFormat.OfJSONSchema == nil || !provider.requests[0].ResponseFormat.OfJSONSchema.JSONSchema.Strict.Value {
+		t.Fatalf("expected a strict json_schema response format")
+	}
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(messages))
+	}
+}
+
+func TestConformSchemaFailsAfterRetry(t *testing.T) {
+	conf := newSchemaConf(t)
+	provider := &fakeProvider{rounds: []Round{{Content: `{"m":1}`}}}
+	messages := []openai.ChatCompletionMessageParamUnion{openai.AssistantMessage("```json\n{\"n\":2}\n```")}
+
+	// a valid answer in a code block is accepted without retry
+	if _, _, err := conformSchema(context.Background(), provider, messages, conf, &bytes.Buffer{}); err != nil || len(provider.requests) != 0 {
+		t.Fatalf("expected valid output, got %v", err)
+	}
+
+	messages = []openai.ChatCompletionMessageParamUnion{openai.AssistantMessage("no json")}
+	_, _, err := conformSchema(context.Background(), provider, messages, conf, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "does not match the schema") {
+		t.Fatalf("expected schema error, got %v", err)
+	}
+}
+
+func TestChatTimesOut(t *testing.T) {
+	// the gateway accepts the request but never answers
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	conf := &utils.AppConf{
+		LLM:    utils.LLM{Gateway: srv.URL, Model: "test", Provider: "openai"},
+		Prompt: &utils.Prompt{User: "hi", Timeout: 100 * time.Millisecond},
+	}
+	start := time.Now()
+	err := Chat(context.Background(), conf, io.Discard)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("chat is not aborted in time: %s", elapsed)
+	}
+}
+
+func TestBudgetStopsToolLoop(t *testing.T) {
+	toolCall := openai.ChatCompletionChunkChoiceDeltaToolCall{ID: "call_1"}
+	toolCall.Function.Name = "add"
+	p := &fakeProvider{rounds: []Round{{
+		ToolCalls: []openai.ChatCompletionChunkChoiceDeltaToolCall{toolCall},
+		Usage:     openai.CompletionUsage{PromptTokens: 900, CompletionTokens: 200, TotalTokens: 1100},
+	}}}
+	conf := &utils.AppConf{
+		LLM:    utils.LLM{Model: "test", Pricing: &utils.Pricing{Input: 1000, Output: 1000}},
+		Prompt: &utils.Prompt{MaxTokens: 1000},
+	}
+	var sleeps []time.Duration
+	chain := newTestChain(&sleeps, candidate{conf: conf.LLM, provider: p})
+	chain.prompt = conf.Prompt
+
+	// the tools are not called, there is no mcp server to call them
+	_, _, err := llmToolCall(context.Background(), chain, nil, conf, io.Discard)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected budget exceeded, got %v", err)
+	}
+	if conf.Prompt.Usage.TotalTokens != 1100 || math.Abs(conf.Prompt.Cost-1.1) > 1e-9 {
+		t.Fatalf("unexpected accumulated usage %+v, cost %v", conf.Prompt.Usage, conf.Prompt.Cost)
+	}
+	if len(chain.entries) != 1 || chain.entries[0].PromptTokens != 900 {
+		t.Fatalf("unexpected ledger entries %+v", chain.entries)
+	}
+
+	// the next chat is refused before any request
+	conf.Prompt.MaxTokens = 0
+	conf.Prompt.MaxCost = 1
+	if _, _, err := llmToolCall(context.Background(), chain, nil, conf, io.Discard); !errors.Is(err, ErrBudgetExceeded) || len(p.requests) != 1 {
+		t.Fatalf("expected budget exceeded without request, got %v after %d requests", err, len(p.requests))
+	}
+}
+
+func TestDeniedToolCallIsSentBack(t *testing.T) {
+	toolCall := openai.ChatCompletionChunkChoiceDeltaToolCall{ID: "call_1"}
+	toolCall.Function.Name = "delete_file"
+	toolCall.Function.Arguments = `{"path":"/"}`
+	p := &fakeProvider{rounds: []Round{
+		{ToolCalls: []openai.ChatCompletionChunkChoiceDeltaToolCall{toolCall}},
+		{Content: "ok, not deleted"},
+	}}
+	var asked []string
+	conf := &utils.AppConf{
+		LLM: utils.LLM{Model: "test"},
+		Prompt: &utils.Prompt{ApproveTool: func(name, arguments string) (string, bool, error) {
+			asked = append(asked, name+" "+arguments)
+			return arguments, false, nil
+		}},
+	}
+
+	// the denied call is not executed, there is no mcp server to execute it
+	messages, _, err := llmToolCall(context.Background(), p, nil, conf, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 1 || asked[0] != `delete_file {"path":"/"}` {
+		t.Fatalf("unexpected approvals %v", asked)
+	}
+	if len(messages) != 3 || messages[1].OfTool == nil || !strings.Contains(messages[1].OfTool.Content.OfString.Value, "denied") {
+		t.Fatalf("expected the denial sent back, got %+v", messages)
+	}
+	if len(p.requests) != 2 {
+		t.Fatalf("expected the model asked again, got %d requests", len(p.requests))
+	}
+}
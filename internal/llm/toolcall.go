@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+// DefaultToolConcurrency is the max count of tools called at the same time when Prompt.ToolConcurrency is not set.
+const DefaultToolConcurrency = 4
+
+// callTools calls the tools of a round, and returns their results in the order of the calls.
+// The calls are approved one by one first, then the approved ones run concurrently, at most Prompt.ToolConcurrency
+// at a time. The arguments of the calls are replaced by the approved ones.
+// A failed call is sent back to the model as an error, so it can retry, failures counts the consecutive failures
+// of each tool, ErrToolFailures is returned when a tool fails Prompt.MaxToolFailures times in a row.
+// The images of the results are not sent when noImages is set.
+func callTools(ctx context.Context, conf *utils.AppConf, toolCalls []openai.ChatCompletionChunkChoiceDeltaToolCall, failures map[string]int, noImages bool) ([]openai.ChatCompletionMessageParamUnion, error) {
+	results := make([]openai.ChatCompletionMessageParamUnion, len(toolCalls))
+	images := make([][]string, len(toolCalls))
+	errs := make([]error, len(toolCalls))
+
+	approved := make([]int, 0, len(toolCalls))
+	for i := range toolCalls {
+		toolCall := &toolCalls[i]
+		slog.Info("Model call ", "tool", toolCall.Function.Name, "args", toolCall.Function.Arguments)
+		ok, err := approveTool(conf, toolCall)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			slog.Warn("tool call denied", "tool", toolCall.Function.Name)
+			results[i] = openai.ToolMessage("error: the user denied the call of tool "+toolCall.Function.Name+", do not retry it", toolCall.ID)
+			continue
+		}
+		approved = append(approved, i)
+	}
+
+	limit := conf.Prompt.ToolConcurrency
+	if limit <= 0 {
+		limit = DefaultToolConcurrency
+	}
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, i := range approved {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], images[i], errs[i] = callTool(ctx, conf, toolCalls[i])
+			if errs[i] == nil {
+				slog.Info("Model call result ", "tool", toolCalls[i].Function.Name, "result", results[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, i := range approved {
+		name, err := toolCalls[i].Function.Name, errs[i]
+		if err == nil {
+			failures[name] = 0
+			continue
+		}
+		// the chat is canceled or timed out, it's not a failure of the tool
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		conf.Prompt.ToolFailures++
+		failures[name]++
+		slog.Warn("Error calling tool", "tool", name, "failures", failures[name], "err", err)
+		if conf.Prompt.MaxToolFailures > 0 && failures[name] >= conf.Prompt.MaxToolFailures {
+			return nil, fmt.Errorf("%w: %s failed %d times in a row: %w", ErrToolFailures, name, failures[name], err)
+		}
+		results[i] = openai.ToolMessage("error: "+err.Error(), toolCalls[i].ID)
+	}
+	// a user message can not be put between the tool messages, so the images follow all of them
+	for i, urls := range images {
+		if len(urls) == 0 {
+			continue
+		}
+		if noImages {
+			slog.Info("the images of the tool result are not sent", "tool", toolCalls[i].Function.Name, "images", len(urls))
+			continue
+		}
+		results = append(results, toolImagesMessage(toolCalls[i], urls))
+	}
+	return results, nil
+}
+
+// activeNoImages reports whether the model in use does not accept images, it's the active model of a fallback chain.
+func activeNoImages(provider Provider, conf *utils.AppConf) bool {
+	if chain, ok := provider.(*chainProvider); ok {
+		return chain.Active().NoImages
+	}
+	return conf.LLM.NoImages
+}
+
+// toolImagesMessage is a user message with the images of a tool result.
+func toolImagesMessage(toolCall openai.ChatCompletionChunkChoiceDeltaToolCall, urls []string) openai.ChatCompletionMessageParamUnion {
+	parts := []openai.ChatCompletionContentPartUnionParam{
+		openai.TextContentPart(fmt.Sprintf("the images of the result of tool %s (%s):", toolCall.Function.Name, toolCall.ID)),
+	}
+	for _, url := range urls {
+		parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: url}))
+	}
+	return openai.UserMessage(parts)
+}
+
+// approveTool asks Prompt.ApproveTool whether the tool is called, the arguments of toolCall are replaced by the approved ones.
+// A call is approved when there is no ApproveTool.
+func approveTool(conf *utils.AppConf, toolCall *openai.ChatCompletionChunkChoiceDeltaToolCall) (bool, error) {
+	if conf.Prompt.ApproveTool == nil {
+		return true, nil
+	}
+	arguments, approved, err := conf.Prompt.ApproveTool(toolCall.Function.Name, toolCall.Function.Arguments)
+	if err != nil {
+		return false, err
+	}
+	toolCall.Function.Arguments = arguments
+	return approved, nil
+}
+
+// callTool calls a tool of the MCP servers, it's limited by Prompt.ToolTimeout.
+// It returns the tool message and the images of the result.
+func callTool(ctx context.Context, conf *utils.AppConf, toolCall openai.ChatCompletionChunkChoiceDeltaToolCall) (openai.ChatCompletionMessageParamUnion, []string, error) {
+	callCtx := ctx
+	if conf.Prompt.ToolTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, conf.Prompt.ToolTimeout)
+		defer cancel()
+	}
+	result, images, err := conf.Prompt.MCPServers.CallToolOpenAI(callCtx, toolCall)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return result, nil, fmt.Errorf("tool %s timed out after %s: %w", toolCall.Function.Name, conf.Prompt.ToolTimeout, err)
+	}
+	return result, images, err
+}
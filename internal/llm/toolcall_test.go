@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+func newToolCall(id, name, arguments string) openai.ChatCompletionChunkChoiceDeltaToolCall {
+	toolCall := openai.ChatCompletionChunkChoiceDeltaToolCall{ID: id}
+	toolCall.Function.Name = name
+	toolCall.Function.Arguments = arguments
+	return toolCall
+}
+
+func TestToolCallsRunConcurrently(t *testing.T) {
+	// the calls are answered only when all of them arrive, so they hang if run one by one
+	const calls = 3
+	var arrived atomic.Int32
+	all := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if arrived.Add(1) == calls {
+			close(all)
+		}
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+		}
+		w.Write([]byte("echo " + r.URL.Query().Get("n")))
+	}))
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "echo.mcp.yaml")
+	err := os.WriteFile(config, []byte(`
+tools:
+  - name: "echo"
+    url: "`+srv.URL+`"
+    method: "GET"
+    inputSchema:
+      type: "object"
+      properties:
+        n:
+          type: "string"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, err := mcps.New(context.Background(), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer servers.Shutdown()
+
+	toolCalls := make([]openai.ChatCompletionChunkChoiceDeltaToolCall, 0, calls)
+	for i := range calls {
+		toolCalls = append(toolCalls, newToolCall(fmt.Sprint("call_", i), "echo", fmt.Sprintf(`{"n":"%d"}`, i)))
+	}
+	conf := &utils.AppConf{Prompt: &utils.Prompt{MCPServers: servers, ToolConcurrency: calls}}
+
+	start := time.Now()
+	results, err := callTools(context.Background(), conf, toolCalls, make(map[string]int), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("the tools are not called concurrently, it takes %s", elapsed)
+	}
+	for i, result := range results {
+		if result.OfTool == nil || result.OfTool.ToolCallID != fmt.Sprint("call_", i) || result.OfTool.Content.OfString.Value != fmt.Sprint("echo ", i) {
+			t.Fatalf("unexpected result %d: %+v", i, result.OfTool)
+		}
+	}
+}
+
+func TestMaxToolRounds(t *testing.T) {
+	p := &fakeProvider{rounds: []Round{{
+		ToolCalls: []openai.ChatCompletionChunkChoiceDeltaToolCall{newToolCall("call_1", "search", `{}`)},
+	}}}
+	conf := &utils.AppConf{
+		LLM: utils.LLM{Model: "test"},
+		Prompt: &utils.Prompt{
+			MaxToolRounds: 2,
+			// the calls are denied, so no mcp server is needed
+			ApproveTool: func(name, arguments string) (string, bool, error) { return arguments, false, nil },
+		},
+	}
+	// the model keeps calling tools even they are disabled
+	messages, _, err := llmToolCall(context.Background(), p, nil, conf, io.Discard)
+	if !errors.Is(err, ErrMaxToolRounds) {
+		t.Fatalf("expected max tool rounds, got %v", err)
+	}
+	if len(p.requests) != 4 || len(messages) != 5 {
+		t.Fatalf("expected 2 rounds of tool calls and a final request, got %d requests and %d messages", len(p.requests), len(messages))
+	}
+	if p.requests[2].ToolChoice.OfAuto.Valid() || p.requests[3].ToolChoice.OfAuto.Value != "none" {
+		t.Fatalf("expected the tools disabled in the final request only")
+	}
+
+	// the model answers once the tools are disabled
+	p = &fakeProvider{rounds: append(slices.Repeat(p.rounds, 3), Round{Content: "done"})}
+	messages, _, err = llmToolCall(context.Background(), p, nil, conf, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.requests) != 4 || lastAnswer(messages) != "done" {
+		t.Fatalf("expected the final answer, got %d requests and %q", len(p.requests), lastAnswer(messages))
+	}
+}
+
+func TestToolFailuresSentBack(t *testing.T) {
+	servers, err := mcps.New(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{rounds: []Round{
+		{ToolCalls: []openai.ChatCompletionChunkChoiceDeltaToolCall{newToolCall("call_1", "missing", `{}`)}},
+		{ToolCalls: []openai.ChatCompletionChunkChoiceDeltaToolCall{newToolCall("call_2", "missing", `{"bad`)}},
+		{Content: "sorry"},
+	}}
+	conf := &utils.AppConf{
+		LLM:    utils.LLM{Model: "test"},
+		Prompt: &utils.Prompt{MCPServers: servers, MaxToolFailures: 3},
+	}
+	messages, _, err := llmToolCall(context.Background(), p, nil, conf, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 5 || conf.Prompt.ToolFailures != 2 {
+		t.Fatalf("expected 2 failures sent back, got %d messages and %d failures", len(messages), conf.Prompt.ToolFailures)
+	}
+	for _, i := range []int{1, 3} {
+		if text := messages[i].OfTool.Content.OfString.Value; !strings.HasPrefix(text, "error: ") {
+			t.Fatalf("expected an error message, got %q", text)
+		}
+	}
+
+	// the third failure in a row aborts the chat
+	p = &fakeProvider{rounds: p.rounds[:1]}
+	conf.Prompt.ToolFailures = 0
+	if _, _, err := llmToolCall(context.Background(), p, nil, conf, io.Discard); !errors.Is(err, ErrToolFailures) {
+		t.Fatalf("expected too many tool failures, got %v", err)
+	}
+	if len(p.requests) != 3 || conf.Prompt.ToolFailures != 3 {
+		t.Fatalf("expected 3 failed rounds, got %d requests and %d failures", len(p.requests), conf.Prompt.ToolFailures)
+	}
+}
+
+func TestNoImagesOfActiveModel(t *testing.T) {
+	conf := &utils.AppConf{
+		LLM:    utils.LLM{Model: "vision", Fallback: []string{"text"}},
+		LLMs:   map[string]utils.LLM{"text": {Model: "text", NoImages: true}},
+		Prompt: &utils.Prompt{},
+	}
+	chain := newChainProvider(conf)
+	if activeNoImages(chain, conf) {
+		t.Fatal("expected the images sent to the first model")
+	}
+	// the chat falls back to the model without images
+	chain.active = 1
+	if !activeNoImages(chain, conf) {
+		t.Fatal("expected no images sent to the fallback")
+	}
+}
@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// wireRequest is the part of a chat completion request, which the native providers need.
+// The request is decoded from its JSON form, so the providers do not depend on the param unions of the sdk.
+type wireRequest struct {
+	Model           string        `json:"model"`
+	Messages        []wireMessage `json:"messages"`
+	Tools           []wireTool    `json:"tools"`
+	ToolChoice      any           `json:"tool_choice"`
+	Temperature     *float64      `json:"temperature"`
+	ReasoningEffort string        `json:"reasoning_effort"`
+	ResponseFormat  *wireFormat   `json:"response_format"`
+}
+
+type wireMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []wireToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+}
+
+type wireToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type wireTool struct {
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+type wireFormat struct {
+	Type       string `json:"type"`
+	JSONSchema *struct {
+		Name   string          `json:"name"`
+		Schema json.RawMessage `json:"schema"`
+		Strict bool            `json:"strict"`
+	} `json:"json_schema"`
+}
+
+// wirePart is a part of a message content, text or image.
+type wirePart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+// decodeRequest converts a chat completion request to its wire form.
+func decodeRequest(req openai.ChatCompletionNewParams) (wireRequest, error) {
+	var wr wireRequest
+	body, err := json.Marshal(req)
+	if err != nil {
+		return wr, err
+	}
+	err = json.Unmarshal(body, &wr)
+	return wr, err
+}
+
+// toolsDisabled reports whether the tool choice is "none", the model must answer without calling the tools.
+func (wr wireRequest) toolsDisabled() bool {
+	return wr.ToolChoice == "none"
+}
+
+// parts returns the content of the message as a list of parts, a string content becomes a text part.
+func (m wireMessage) parts() []wirePart {
+	if len(m.Content) == 0 {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(m.Content, &text); err == nil {
+		if text == "" {
+			return nil
+		}
+		return []wirePart{{Type: "text", Text: text}}
+	}
+	var parts []wirePart
+	json.Unmarshal(m.Content, &parts)
+	return parts
+}
+
+// text returns all text parts of the message content.
+func (m wireMessage) text() string {
+	var texts []string
+	for _, part := range m.parts() {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// parseDataURL splits a data URL into its mime type and base64 data.
+// ok is false when the url is not a base64 data URL.
+func parseDataURL(url string) (mimeType string, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mimeType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
+
+// validJSONObject returns args if it is valid JSON, otherwise an empty object.
+func validJSONObject(args string) json.RawMessage {
+	if strings.TrimSpace(args) == "" || !json.Valid([]byte(args)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(args)
+}
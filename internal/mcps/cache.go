@@ -0,0 +1,151 @@
+package mcps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// CacheDir is the folder where the lists of the stdio servers are cached, no list is cached when it's empty.
+// A stdio server whose lists are cached is started when one of its tools is called.
+var CacheDir string
+
+// serverLists are the tools, resources and prompts listed by a server.
+// Key and ModTime identify the server whose lists are cached, see serverStart.cacheKey.
+type serverLists struct {
+	Key       string                 `json:"key"`
+	ModTime   time.Time              `json:"modTime"`
+	Tools     []mcp.Tool             `json:"tools"`
+	Resources []mcp.Resource         `json:"resources,omitempty"`
+	Templates []mcp.ResourceTemplate `json:"templates,omitempty"`
+	Prompts   map[string]string      `json:"prompts,omitempty"`
+}
+
+// cacheKey returns the key of the cached lists of a stdio server, and the latest modification time of its command
+// and of the files in its arguments, so the lists are listed again when the server is updated.
+// The key is a SHA-256 of the command, arguments and environment, so no secret of them is written to the cache.
+// ok is false for the other servers, whose lists are not cached.
+func (s serverStart) cacheKey() (key string, modTime time.Time, ok bool) {
+	if CacheDir == "" {
+		return "", time.Time{}, false
+	}
+	var command, dir string
+	var args, parts []string
+	if s.conf != nil {
+		if transport, err := s.conf.transport(); err != nil || transport != "stdio" {
+			return "", time.Time{}, false
+		}
+		command, args, dir = s.conf.Command, s.conf.Args, s.conf.Cwd
+		parts = append(append([]string{command}, args...), "cwd="+dir)
+		env := make([]string, 0, len(s.conf.Env))
+		for k, v := range s.conf.Env {
+			env = append(env, k+"="+v)
+		}
+		sort.Strings(env)
+		parts = append(parts, env...)
+	} else {
+		if !isLocal(s.provider) || IsProxyMCPConfig(s.provider) || IsOpenAPIProxyConfig(s.provider) {
+			return "", time.Time{}, false
+		}
+		fields := strings.Split(s.provider, " ")
+		command, args = fields[0], fields[1:]
+		parts = []string{s.provider}
+	}
+	modTime, ok = latestModTime(command, args, dir)
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:]), modTime, ok
+}
+
+// latestModTime returns the latest modification time of the command and of the arguments which are files,
+// a relative path is relative to dir when it's set. ok is false when the command is not found.
+func latestModTime(command string, args []string, dir string) (time.Time, bool) {
+	path := func(name string) string {
+		if dir != "" && !filepath.IsAbs(name) {
+			return filepath.Join(dir, name)
+		}
+		return name
+	}
+	exe := path(command)
+	if !strings.ContainsAny(command, `/\`) {
+		var err error
+		if exe, err = exec.LookPath(command); err != nil {
+			return time.Time{}, false
+		}
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return time.Time{}, false
+	}
+	latest := info.ModTime()
+	for _, arg := range args {
+		if info, err := os.Stat(path(arg)); err == nil && info.Mode().IsRegular() && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, true
+}
+
+// cachePath returns the file of the cached lists of a key.
+func cachePath(key string) string {
+	return filepath.Join(CacheDir, key[:16]+".json")
+}
+
+// cachedClient returns a client of the server made of its cached lists, the server is not started.
+// It's nil when the server is not a stdio server, or its lists are not cached, or the server is updated.
+func (s serverStart) cachedClient() *McpClient {
+	key, modTime, ok := s.cacheKey()
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(cachePath(key))
+	if err != nil {
+		return nil
+	}
+	var lists serverLists
+	if err := json.Unmarshal(data, &lists); err != nil || lists.Key != key || !lists.ModTime.Equal(modTime) {
+		slog.Debug("cached mcp tools are not used", "provider", s.provider, "error", err)
+		return nil
+	}
+	storePrompts(lists.Prompts)
+	client := &McpClient{
+		provider:    s.provider,
+		tools:       lists.Tools,
+		resources:   lists.Resources,
+		templates:   lists.Templates,
+		lazy:        &s,
+		cachedTools: lists.Tools,
+	}
+	if s.conf != nil {
+		client.name = invalidName.ReplaceAllString(s.name, "_")
+	}
+	slog.Debug("mcp server starts when its tools are called", "provider", s.provider, "tools", len(lists.Tools))
+	return client
+}
+
+// saveCache caches the lists of a stdio server.
+func (s serverStart) saveCache(lists *serverLists) {
+	key, modTime, ok := s.cacheKey()
+	if !ok {
+		return
+	}
+	lists.Key, lists.ModTime = key, modTime
+	data, err := json.Marshal(lists)
+	if err == nil {
+		err = os.MkdirAll(CacheDir, 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(cachePath(key), data, 0600)
+	}
+	if err != nil {
+		slog.Debug("failed to cache mcp tools", "provider", s.provider, "error", err)
+	}
+}
@@ -4,18 +4,46 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	mcpc "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// shutdownGrace is how long a stdio server is given to exit after its stdin is closed.
+const shutdownGrace = 2 * time.Second
+
 // McpClient is a wrapper around the mcpc.MCPClient.
 // It holds the client and the provider string.
 type McpClient struct {
 	client   mcpc.MCPClient
 	provider string
+	// name is the short name of the server, it qualifies its tools whose names collide with another server.
+	name string
+	// tools are the tools listed by the server, toolsChanged is set when the server notifies they changed.
+	// tools are guarded by MCPs.mu once the client is added.
+	tools        []mcp.Tool
+	toolsChanged atomic.Bool
+	// cmd is the process of a stdio server, and startScript is the script generated to start it.
+	cmd         *exec.Cmd
+	startScript string
+	// oauth authorizes a remote server which requires OAuth, it's nil for other servers.
+	oauth *oauthFlow
+	// resources and templates are listed when the client is added.
+	resources []mcp.Resource
+	templates []mcp.ResourceTemplate
+	// lazy is the server of a client created from the cache, it's started by ensureStarted when it's used.
+	// cachedTools are the tools of the cache, they are not changed, so ensureStarted compares the listed tools without MCPs.mu.
+	lazy        *serverStart
+	cachedTools []mcp.Tool
+	startMu     sync.Mutex
 }
 
 func isLocal(provider string) bool {
@@ -24,11 +52,11 @@ func isLocal(provider string) bool {
 
 // NewClient creates a new McpClient based on the provider string.
 // It can create either a local or a remote client.
-func NewClient(provider string) (*McpClient, error) {
+func NewClient(ctx context.Context, provider string) (*McpClient, error) {
 	if isLocal(provider) {
 		return NewLocalClient(provider)
 	} else {
-		return NewRemoteClient(provider)
+		return NewRemoteClient(ctx, provider)
 	}
 }
 
@@ -59,45 +87,160 @@ func NewLocalClient(provider string) (*McpClient, error) {
 	}
 
 	exeName, args := buildExecutable(provider)
+	return newStdioClient(provider, exeName, args, nil, "")
+}
 
-	client, err := mcpc.NewStdioMCPClient(exeName, []string{}, args...)
-	if err != nil {
+// newStdioClient starts a stdio server with the environment variables added to the current ones, in dir when it's not empty.
+func newStdioClient(provider string, exeName string, args []string, env []string, dir string) (*McpClient, error) {
+	c := &McpClient{
+		provider: provider,
+	}
+	if exeName == currentShell() && len(args) > 0 && path.Base(args[0]) == ".mcp.start"+shellExt() {
+		c.startScript = args[0]
+	}
+
+	// the process is not bound to a context, it lives until Close, which kills it with its children
+	stdio := transport.NewStdioWithOptions(exeName, env, args, transport.WithCommandFunc(
+		func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+			cmd := exec.Command(command, args...)
+			cmd.Env = append(os.Environ(), env...)
+			cmd.Dir = dir
+			setProcessGroup(cmd)
+			c.cmd = cmd
+			return cmd, nil
+		}))
+	if err := stdio.Start(context.Background()); err != nil {
+		c.removeStartScript()
 		return nil, err
 	}
-	return &McpClient{
-		client:   client,
-		provider: provider,
-	}, nil
+	c.client = mcpc.NewClient(stdio)
+	return c, nil
 }
 
 // NewRemoteClient creates a new remote McpClient.
 // It can be either a http client or a sse client.
-func NewRemoteClient(provider string) (*McpClient, error) {
+func NewRemoteClient(ctx context.Context, provider string) (*McpClient, error) {
+	return newRemoteClient(ctx, provider, provider, strings.Contains(provider, "sse"), nil, nil)
+}
+
+// newRemoteClient connects to the server at url by sse or streamable http, the headers are sent with each request.
+// When oauth is set, the server is authorized by the OAuth flow once it asks for it.
+func newRemoteClient(ctx context.Context, provider string, url string, sse bool, headers map[string]string, oauth *OAuthConfig) (*McpClient, error) {
+	c := &McpClient{
+		provider: provider,
+	}
+	var oauthConfig transport.OAuthConfig
+	if oauth != nil {
+		var err error
+		c.oauth, oauthConfig, err = newOAuthFlow(provider, url, oauth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var client *mcpc.Client
 	var err error
-	if !strings.Contains(provider, "sse") {
-		client, err = mcpc.NewStreamableHttpClient(provider)
+	if !sse {
+		opts := []transport.StreamableHTTPCOption{transport.WithHTTPHeaders(headers)}
+		if c.oauth != nil {
+			opts = append(opts, transport.WithHTTPOAuth(oauthConfig))
+		}
+		client, err = mcpc.NewStreamableHttpClient(url, opts...)
 		if err != nil {
 			slog.Error("Failed to create HTTP client", "provider", provider, "error", err)
 			return nil, err
 		}
 	} else {
-		client, err = mcpc.NewSSEMCPClient(provider)
+		opts := []transport.ClientOption{transport.WithHeaders(headers)}
+		if c.oauth != nil {
+			opts = append(opts, transport.WithOAuth(oauthConfig))
+		}
+		client, err = mcpc.NewSSEMCPClient(url, opts...)
 		if err != nil {
 			slog.Error("Failed to create SSE client", "provider", provider, "error", err)
 			return nil, err
 		}
 	}
-	err = client.Start(context.Background())
+	c.client = client
+
+	// the connection lives until Close, ctx only limits the start
+	err = client.Start(context.WithoutCancel(ctx))
+	if c.oauth != nil && mcpc.IsOAuthAuthorizationRequiredError(err) {
+		if err := c.oauth.authorize(ctx, mcpc.GetOAuthHandler(err)); err != nil {
+			return nil, err
+		}
+		err = client.Start(context.WithoutCancel(ctx))
+	}
 	if err != nil {
 		slog.Error("Failed to start MCP client", "error", err)
 		return nil, err
 	}
 
-	return &McpClient{
-		client:   client,
-		provider: provider,
-	}, nil
+	return c, nil
+}
+
+// initialize initializes the session, a server which asks for OAuth authorization is authorized first.
+func (c *McpClient) initialize(ctx context.Context) (*mcp.InitializeResult, error) {
+	c.enableSampling()
+	c.enableElicitation()
+	req := mcp.InitializeRequest{
+		Params: mcp.InitializeParams{
+			ProtocolVersion: "2025-03-26",
+		},
+	}
+	result, err := c.client.Initialize(ctx, req)
+	if c.oauth != nil && mcpc.IsOAuthAuthorizationRequiredError(err) {
+		if err := c.oauth.authorize(ctx, mcpc.GetOAuthHandler(err)); err != nil {
+			return nil, err
+		}
+		result, err = c.client.Initialize(ctx, req)
+	}
+	return result, err
+}
+
+// Close closes the client, a stdio server which does not exit in time is killed with all of its children.
+// A client whose server is not started has nothing to close.
+func (c *McpClient) Close() {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	if c.client == nil {
+		return
+	}
+	c.close()
+}
+
+func (c *McpClient) close() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := c.client.Close(); err != nil {
+			slog.Debug("failed to close client", "provider", c.provider, "error", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+		slog.Warn("mcp server does not exit in time", "provider", c.provider)
+	}
+	if c.cmd != nil && c.cmd.Process != nil {
+		// the server may have left children even it exited
+		killProcessTree(c.cmd)
+		select {
+		case <-done:
+		case <-time.After(shutdownGrace):
+		}
+	}
+	c.removeStartScript()
+}
+
+func (c *McpClient) removeStartScript() {
+	if c.startScript == "" {
+		return
+	}
+	if err := os.Remove(c.startScript); err != nil && !os.IsNotExist(err) {
+		slog.Debug("failed to remove start script", "path", c.startScript, "error", err)
+	}
 }
 
 // buildExecutable builds the executable and arguments for a local MCP client.
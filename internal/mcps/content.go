@@ -0,0 +1,76 @@
+package mcps
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolContent converts the result of a tool call for the model, the text parts are joined and the images are returned as
+// data urls, a placeholder of each image is kept in the text, so the model knows where it's from.
+// The structured content is appended as JSON, unless a text part already has it.
+func toolContent(result *mcp.CallToolResult) (string, []string) {
+	texts := make([]string, 0, len(result.Content)+1)
+	images := make([]string, 0)
+	addImage := func(mimeType, data string) {
+		images = append(images, "data:"+mimeType+";base64,"+data)
+		texts = append(texts, fmt.Sprintf("[image %d: %s]", len(images), mimeType))
+	}
+
+	for _, content := range result.Content {
+		switch content := content.(type) {
+		case mcp.TextContent:
+			texts = append(texts, content.Text)
+		case mcp.ImageContent:
+			addImage(content.MIMEType, content.Data)
+		case mcp.AudioContent:
+			texts = append(texts, fmt.Sprintf("[audio: %s, not supported]", content.MIMEType))
+		case mcp.ResourceLink:
+			texts = append(texts, fmt.Sprintf("[resource %s: %s %s]", content.URI, content.Name, content.Description))
+		case mcp.EmbeddedResource:
+			switch resource := content.Resource.(type) {
+			case mcp.TextResourceContents:
+				texts = append(texts, fmt.Sprintf("[resource %s]\n%s", resource.URI, resource.Text))
+			case mcp.BlobResourceContents:
+				if strings.HasPrefix(resource.MIMEType, "image/") {
+					addImage(resource.MIMEType, resource.Blob)
+				} else if data, err := base64.StdEncoding.DecodeString(resource.Blob); err == nil && utf8.Valid(data) {
+					texts = append(texts, fmt.Sprintf("[resource %s]\n%s", resource.URI, data))
+				} else {
+					texts = append(texts, fmt.Sprintf("[resource %s: %s, binary content not supported]", resource.URI, resource.MIMEType))
+				}
+			}
+		}
+	}
+
+	if result.StructuredContent != nil {
+		if data, err := json.Marshal(result.StructuredContent); err == nil && !hasJSON(texts, data) {
+			texts = append(texts, string(data))
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
+
+// hasJSON reports whether one of the texts is the same JSON as data, ignoring the spaces and the order of the keys.
+func hasJSON(texts []string, data []byte) bool {
+	var value any
+	if json.Unmarshal(data, &value) != nil {
+		return false
+	}
+	data, _ = json.Marshal(value)
+	for _, text := range texts {
+		var value any
+		if json.Unmarshal([]byte(text), &value) != nil {
+			continue
+		}
+		if normalized, err := json.Marshal(value); err == nil && bytes.Equal(normalized, data) {
+			return true
+		}
+	}
+	return false
+}
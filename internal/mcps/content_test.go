@@ -0,0 +1,58 @@
+package mcps
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestToolContent(t *testing.T) {
+	result := &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent("first"),
+			mcp.NewImageContent("aW1n", "image/png"),
+			mcp.NewTextContent(`{"b": 2, "a": 1}`),
+			mcp.NewAudioContent("YXVkaW8=", "audio/wav"),
+			mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "file:///a.txt", Text: "text of a"}),
+			mcp.NewEmbeddedResource(mcp.BlobResourceContents{URI: "file:///b.jpg", MIMEType: "image/jpeg", Blob: "anBn"}),
+		},
+		// it's the same as the JSON text part, so it's not repeated
+		StructuredContent: map[string]any{"a": 1, "b": 2},
+	}
+	text, images := toolContent(result)
+	want := "first\n[image 1: image/png]\n" + `{"b": 2, "a": 1}` + "\n[audio: audio/wav, not supported]\n[resource file:///a.txt]\ntext of a\n[image 2: image/jpeg]"
+	if text != want {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if !slices.Equal(images, []string{"data:image/png;base64,aW1n", "data:image/jpeg;base64,anBn"}) {
+		t.Fatalf("unexpected images %v", images)
+	}
+
+	text, _ = toolContent(&mcp.CallToolResult{StructuredContent: map[string]any{"n": 1}})
+	if text != `{"n":1}` {
+		t.Fatalf("expected the structured content as JSON, got %q", text)
+	}
+}
+
+func TestCallToolWithImage(t *testing.T) {
+	s := server.NewMCPServer("screen", "1.0.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("screenshot"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultImage("the screen", "aW1n", "image/png"), nil
+	})
+	m := &MCPs{clients: []*McpClient{newServerTestClient(t, "screen", s)}}
+	m.registerTools()
+
+	msg, images, err := m.CallTool(context.Background(), "call_1", "screenshot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.OfTool.Content.OfString.Value; got != "the screen\n[image 1: image/png]" {
+		t.Fatalf("unexpected text %q", got)
+	}
+	if !slices.Equal(images, []string{"data:image/png;base64,aW1n"}) {
+		t.Fatalf("unexpected images %v", images)
+	}
+}
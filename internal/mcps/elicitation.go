@@ -0,0 +1,41 @@
+package mcps
+
+import (
+	"context"
+
+	mcpc "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Elicitor asks the user for the input requested by a server, server is the name of the server which asks.
+type Elicitor interface {
+	Elicit(ctx context.Context, server string, req mcp.ElicitationRequest) (*mcp.ElicitationResult, error)
+}
+
+// Elicitation answers the elicitation requests of the servers started after it's set, the servers can not ask
+// the user when it's nil.
+var Elicitation Elicitor
+
+// elicitationHandler passes the elicitation requests of a client to Elicitation with the name of its server.
+type elicitationHandler struct {
+	client   *McpClient
+	elicitor Elicitor
+}
+
+func (h *elicitationHandler) Elicit(ctx context.Context, req mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	name := h.client.name
+	if name == "" {
+		name = serverName(h.client.provider)
+	}
+	return h.elicitor.Elicit(ctx, name, req)
+}
+
+// enableElicitation declares the elicitation capability of the client when Elicitation is set,
+// it must be called before initialize.
+func (c *McpClient) enableElicitation() {
+	client, ok := c.client.(*mcpc.Client)
+	if !ok || Elicitation == nil {
+		return
+	}
+	mcpc.WithElicitationHandler(&elicitationHandler{client: c, elicitor: Elicitation})(client)
+}
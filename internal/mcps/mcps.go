@@ -4,143 +4,211 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/shared"
 )
 
 // MCPs is a collection of MCP clients.
 // It manages the lifecycle of the clients and provides a single entry point for calling tools.
 type MCPs struct {
-	toolToClient map[string]*McpClient
+	// mu guards the tools, they are rebuilt when a server notifies its tools changed.
+	mu           sync.RWMutex
+	toolToClient map[string]serverTool
 	clients      []*McpClient
-	Tools        []openai.ChatCompletionToolUnionParam
+	// Tools are the tools offered to the model, a tool is named as server__tool when another server has a tool of the same name.
+	Tools []openai.ChatCompletionToolUnionParam
+	// allow and deny are the glob patterns which filter the tools.
+	allow []string
+	deny  []string
+	// servers are the configured servers, a provider can be one of their names.
+	servers map[string]ServerConfig
 }
 
 // New creates a new MCPs instance.
-// It initializes the clients and lists the available tools.
-func New(providers ...string) (*MCPs, error) {
+// It starts the servers and lists the available tools, see Add.
+// A provider is a name of the configured servers, a mcp.json file of servers, a file path (stdio) or a url.
+func New(ctx context.Context, servers map[string]ServerConfig, providers ...string) (*MCPs, error) {
 	mcps := &MCPs{
-		toolToClient: make(map[string]*McpClient),
+		servers:      servers,
+		toolToClient: make(map[string]serverTool),
 		clients:      make([]*McpClient, 0),
 		Tools:        make([]openai.ChatCompletionToolUnionParam, 0),
 	}
 
-	for _, provider := range providers {
+	if err := mcps.Add(ctx, providers...); err != nil {
+		mcps.Shutdown()
+		return nil, err
+	}
 
-		client, err := NewClient(provider)
-		if err != nil {
-			slog.Warn("failed to create client", "provider", provider, "error", err)
-			mcps.Shutdown()
-			return nil, err
-		}
+	return mcps, nil
+}
 
-		mcps.clients = append(mcps.clients, client)
-	}
-
-	ctx := context.Background()
-	tools := make([]openai.ChatCompletionToolUnionParam, 0)
-	for _, client := range mcps.clients {
-		_, err := client.client.Initialize(ctx, mcp.InitializeRequest{
-			Params: mcp.InitializeParams{
-				ProtocolVersion: "2025-03-26",
-			},
-		})
-		if err != nil {
-			slog.Warn("failed to initialize client", "provider", client.provider, "error", err)
-			mcps.Shutdown()
-			return nil, err
-		}
-		resp, err := client.client.ListTools(ctx, mcp.ListToolsRequest{})
-		if err != nil {
-			slog.Warn("failed to list tools", "provider", client.provider, "error", err)
-			mcps.Shutdown()
-			return nil, err
+// Add starts more MCP servers concurrently and registers their tools, each server is limited by StartTimeout.
+// A server which fails to start is skipped with a warning, unless it's required, then none of the new servers is added.
+// The clients already added are kept alive. A stdio server whose tools are cached is started when one of them is called.
+func (m *MCPs) Add(ctx context.Context, providers ...string) error {
+	starts := make([]serverStart, 0, len(providers))
+	for _, provider := range providers {
+		starts = append(starts, m.serverStarts(provider)...)
+	}
+
+	started := make([]*McpClient, len(starts))
+	errs := make([]error, len(starts))
+	var wg sync.WaitGroup
+	for i, start := range starts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started[i], errs[i] = start.client(ctx)
+		}()
+	}
+	wg.Wait()
+
+	clients := make([]*McpClient, 0, len(started))
+	var err error
+	for i, start := range starts {
+		if errs[i] == nil {
+			clients = append(clients, started[i])
+			continue
 		}
-		for _, tool := range resp.Tools {
-			mcps.toolToClient[tool.Name] = client
-			params := map[string]any{
-				"type":       tool.InputSchema.Type,
-				"properties": tool.InputSchema.Properties,
-				"required":   tool.InputSchema.Required,
-			}
-			description := tool.Description
-			tools = append(tools, openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
-				Name:        tool.Name,
-				Description: openai.String(description),
-				Parameters:  shared.FunctionParameters(params),
-			}))
+		slog.Warn("failed to start mcp server", "provider", start.provider, "error", errs[i])
+		if start.required() && err == nil {
+			err = fmt.Errorf("required mcp server %s: %w", start.provider, errs[i])
 		}
+	}
+	// the servers fail when the start is interrupted, it's not a warning
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		closeClients(clients)
+		return err
+	}
 
-		updateMcpPrompt(client.client)
+	for _, client := range clients {
+		if client.name == "" {
+			client.name = serverName(client.provider)
+		}
+		client.name = m.uniqueServerName(client.name)
+		m.clients = append(m.clients, client)
 	}
-	mcps.Tools = tools
+	registerResources(clients...)
+	m.mu.Lock()
+	m.registerTools()
+	m.mu.Unlock()
 
-	return mcps, nil
+	return nil
 }
 
-// Shutdown closes all the MCP clients.
-func (m *MCPs) Shutdown() {
+// ToolNames returns the names of all available tools.
+func (m *MCPs) ToolNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.Tools))
+	for _, tool := range m.Tools {
+		if tool.OfFunction != nil {
+			names = append(names, tool.OfFunction.Function.Name)
+		}
+	}
+	return names
+}
+
+// Resources returns the resources and the resource templates of all the MCP servers.
+func (m *MCPs) Resources() ([]mcp.Resource, []mcp.ResourceTemplate) {
+	resources := make([]mcp.Resource, 0)
+	templates := make([]mcp.ResourceTemplate, 0)
 	for _, client := range m.clients {
-		client.client.Close()
+		resources = append(resources, client.resources...)
+		templates = append(templates, client.templates...)
 	}
+	return resources, templates
+}
+
+// Shutdown closes all the MCP clients, the stdio servers are killed if they do not exit in time.
+func (m *MCPs) Shutdown() {
+	unregisterResources(m.clients...)
+	closeClients(m.clients)
 	m.clients = nil
+	m.mu.Lock()
 	m.toolToClient = nil
+	m.mu.Unlock()
+}
+
+// closeClients closes the clients concurrently, so a hung server does not delay the others.
+func closeClients(clients []*McpClient) {
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Close()
+		}()
+	}
+	wg.Wait()
 }
 
 // CallToolOpenAI calls a tool with the given name and arguments.
 // It is a wrapper around CallTool that takes an openai.ChatCompletionChunkChoiceDeltaToolCall.
-func (m *MCPs) CallToolOpenAI(ctx context.Context, toolCall openai.ChatCompletionChunkChoiceDeltaToolCall) (openai.ChatCompletionMessageParamUnion, error) {
+func (m *MCPs) CallToolOpenAI(ctx context.Context, toolCall openai.ChatCompletionChunkChoiceDeltaToolCall) (openai.ChatCompletionMessageParamUnion, []string, error) {
 	toolName := toolCall.Function.Name
 	callID := toolCall.ID
 	args := make(map[string]any)
 
+	// a tool without arguments may be called with empty arguments
+	if strings.TrimSpace(toolCall.Function.Arguments) == "" {
+		return m.CallTool(ctx, callID, toolName, args)
+	}
 	err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
 	if err != nil {
-		return openai.ChatCompletionMessageParamUnion{}, err
+		return openai.ChatCompletionMessageParamUnion{}, nil, fmt.Errorf("invalid JSON arguments of %s: %w", toolName, err)
 	}
 
 	return m.CallTool(ctx, callID, toolName, args)
 }
 
 // CallTool calls a tool with the given name and arguments.
-// It returns the result of the tool call as a ChatCompletionMessageParamUnion.
-func (m *MCPs) CallTool(ctx context.Context, callID string, toolName string, args map[string]any) (openai.ChatCompletionMessageParamUnion, error) {
-
-	client, ok := m.toolToClient[toolName]
-	if !ok {
-		return openai.ChatCompletionMessageParamUnion{}, errors.New(toolName + " tool not found")
-	}
-	req := mcp.CallToolRequest{}
-	req.Params.Name = toolName
-	req.Params.Arguments = args
-
-	resp, err := client.client.CallTool(ctx, req)
+// It returns the text parts of the result as a tool message, and the images of the result as data urls,
+// which can be sent to the model in a user message.
+func (m *MCPs) CallTool(ctx context.Context, callID string, toolName string, args map[string]any) (openai.ChatCompletionMessageParamUnion, []string, error) {
+	resp, err := m.CallToolResult(ctx, toolName, args)
 	if err != nil {
-		return openai.ChatCompletionMessageParamUnion{}, err
+		return openai.ChatCompletionMessageParamUnion{}, nil, err
 	}
 
+	text, images := toolContent(resp)
 	if resp.IsError {
-		errMsg := ""
-		if len(resp.Content) > 0 {
-			textContent, ok := resp.Content[0].(mcp.TextContent)
-			if ok {
-				errMsg = textContent.Text
-			}
-		}
-		return openai.ChatCompletionMessageParamUnion{}, errors.New(toolName + " call tool error:" + errMsg)
+		return openai.ChatCompletionMessageParamUnion{}, nil, errors.New(toolName + " call tool error:" + text)
 	}
 
-	if len(resp.Content) == 0 {
-		return openai.ChatCompletionMessageParamUnion{}, errors.New(toolName + " no content")
+	if text == "" && len(images) == 0 {
+		return openai.ChatCompletionMessageParamUnion{}, nil, errors.New(toolName + " no content")
 	}
 
-	callResult, ok := resp.Content[0].(mcp.TextContent)
+	return openai.ToolMessage(text, callID), images, nil
+}
+
+// CallToolResult calls a tool with the given name and arguments, and returns the result as it's responded by the server.
+func (m *MCPs) CallToolResult(ctx context.Context, toolName string, args map[string]any) (*mcp.CallToolResult, error) {
+	m.mu.RLock()
+	tool, ok := m.toolToClient[toolName]
+	m.mu.RUnlock()
 	if !ok {
-		return openai.ChatCompletionMessageParamUnion{}, errors.New(toolName + "invalid content type")
+		return nil, errors.New(toolName + " tool not found")
+	}
+	if err := tool.client.ensureStarted(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start mcp server %s: %w", tool.client.name, err)
 	}
+	token, done := startProgress(toolName)
+	defer done()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = tool.name
+	req.Params.Arguments = args
+	req.Params.Meta = &mcp.Meta{ProgressToken: token}
 
-	return openai.ToolMessage(callResult.Text, callID), nil
+	return tool.client.client.CallTool(ctx, req)
 }
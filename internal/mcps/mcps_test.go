@@ -1,6 +1,7 @@
 package mcps
 
 import (
+	"context"
 	"testing"
 )
 
@@ -12,7 +13,7 @@ func TestStart(t *testing.T) {
 	// streamHttpProvider := "http://127.0.0.1:30030/mcp"
 	proxyProvider := "/home/jia/repo/gpt-cli/samples/qqwry.openapi.yaml"
 
-	s, err := New(proxyProvider)
+	s, err := New(context.Background(), nil, proxyProvider)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,165 @@
+package mcps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Progress is where the progress of the tool calls is shown as a line rewritten in place, nil hides it.
+var Progress io.Writer = os.Stderr
+
+// progressInterval is how often a proxy reports the progress of a HTTP request which is still waiting.
+var progressInterval = 2 * time.Second
+
+// progressCall is a tool call in progress, it's found by its progress token.
+type progressCall struct {
+	tool  string
+	shown atomic.Bool
+}
+
+var (
+	// progressCalls are the tool calls in progress by their tokens.
+	progressCalls sync.Map
+	// progressID makes the tokens of the calls unique in the process, the ids of the tool calls are not,
+	// e.g. ollama numbers them from call_0 in each round.
+	progressID atomic.Int64
+	// progressMu serializes the progress lines of the concurrent calls.
+	progressMu sync.Mutex
+)
+
+// startProgress registers a tool call whose progress is shown, it returns the token to request the progress with,
+// and the function to call when the call ends, which clears the progress line.
+func startProgress(tool string) (mcp.ProgressToken, func()) {
+	token := "progress-" + strconv.FormatInt(progressID.Add(1), 10)
+	call := &progressCall{tool: tool}
+	progressCalls.Store(token, call)
+	return token, func() {
+		progressCalls.Delete(token)
+		if call.shown.Load() && Progress != nil {
+			progressMu.Lock()
+			fmt.Fprint(Progress, "\r\033[K")
+			progressMu.Unlock()
+		}
+	}
+}
+
+// subscribe handles the notifications of the server: the progress of the tool calls is shown on Progress,
+// the log messages are logged by slog, a change of the tools is kept until MCPs.Refresh lists them again.
+func (c *McpClient) subscribe() {
+	c.client.OnNotification(func(notification mcp.JSONRPCNotification) {
+		params := notification.Params.AdditionalFields
+		switch notification.Method {
+		case "notifications/progress":
+			showProgress(params)
+		case "notifications/message":
+			logMessage(c.provider, params)
+		case mcp.MethodNotificationToolsListChanged:
+			slog.Debug("mcp tools changed", "provider", c.provider)
+			c.toolsChanged.Store(true)
+		}
+	})
+}
+
+// showProgress rewrites the progress line of a tool call.
+func showProgress(params map[string]any) {
+	value, ok := progressCalls.Load(fmt.Sprint(params["progressToken"]))
+	if !ok || Progress == nil {
+		return
+	}
+	call := value.(*progressCall)
+	line := call.tool + ": "
+	progress, _ := params["progress"].(float64)
+	if total, _ := params["total"].(float64); total > 0 {
+		line += fmt.Sprintf("%.0f%%", progress*100/total)
+	} else {
+		line += strconv.FormatFloat(progress, 'f', -1, 64)
+	}
+	if message, _ := params["message"].(string); message != "" {
+		line += " " + message
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	fmt.Fprint(Progress, "\r\033[K"+line)
+	call.shown.Store(true)
+}
+
+// logMessage logs a log message of a server at the level of slog matching its level.
+func logMessage(provider string, params map[string]any) {
+	level := slog.LevelInfo
+	switch mcp.LoggingLevel(fmt.Sprint(params["level"])) {
+	case mcp.LoggingLevelDebug:
+		level = slog.LevelDebug
+	case mcp.LoggingLevelWarning:
+		level = slog.LevelWarn
+	case mcp.LoggingLevelError, mcp.LoggingLevelCritical, mcp.LoggingLevelAlert, mcp.LoggingLevelEmergency:
+		level = slog.LevelError
+	}
+	args := []any{"provider", provider}
+	if logger, ok := params["logger"].(string); ok && logger != "" {
+		args = append(args, "logger", logger)
+	}
+	args = append(args, "data", params["data"])
+	slog.Log(context.Background(), level, "mcp server log", args...)
+}
+
+// notifier keeps the notification handlers of a proxy client, a proxy reports the progress of its HTTP requests.
+type notifier struct {
+	mu       sync.RWMutex
+	handlers []func(notification mcp.JSONRPCNotification)
+}
+
+func (n *notifier) add(handler func(notification mcp.JSONRPCNotification)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers = append(n.handlers, handler)
+}
+
+func (n *notifier) notify(method string, params map[string]any) {
+	notification := mcp.JSONRPCNotification{JSONRPC: mcp.JSONRPC_VERSION}
+	notification.Method = method
+	notification.Params.AdditionalFields = params
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, handler := range n.handlers {
+		handler(notification)
+	}
+}
+
+// do sends a HTTP request of a tool call, while it's waiting, the elapsed seconds are reported as the progress
+// of the call when the call asks for it.
+func (n *notifier) do(client *http.Client, req *http.Request, meta *mcp.Meta) (*http.Response, error) {
+	if meta == nil || meta.ProgressToken == nil {
+		return client.Do(req)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		start := time.Now()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				elapsed := time.Since(start).Round(time.Second)
+				n.notify("notifications/progress", map[string]any{
+					"progressToken": meta.ProgressToken,
+					"progress":      elapsed.Seconds(),
+					"message":       "waiting for " + req.URL.Host + " " + elapsed.String(),
+				})
+			}
+		}
+	}()
+	return client.Do(req)
+}
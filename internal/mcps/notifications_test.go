@@ -0,0 +1,99 @@
+package mcps
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a writer which can be read while it's written.
+type lockedBuffer struct {
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.String()
+}
+
+func TestProxyReportsProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "slow.mcp.yaml")
+	err := os.WriteFile(config, []byte(`
+tools:
+  - name: "slow"
+    url: "`+srv.URL+`"
+    method: "GET"
+    inputSchema:
+      type: "object"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out lockedBuffer
+	defer func(w io.Writer, interval time.Duration) {
+		Progress, progressInterval = w, interval
+	}(Progress, progressInterval)
+	Progress, progressInterval = &out, 10*time.Millisecond
+
+	s, err := New(context.Background(), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+	msg, _, err := s.CallTool(context.Background(), "call_1", "slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.OfTool.Content.OfString.Value != "done" {
+		t.Fatalf("unexpected result %+v", msg.OfTool)
+	}
+	shown := out.String()
+	if !strings.Contains(shown, "\r\033[Kslow: ") || !strings.Contains(shown, "waiting for "+strings.TrimPrefix(srv.URL, "http://")) || !strings.HasSuffix(shown, "\r\033[K") {
+		t.Fatalf("unexpected progress %q", shown)
+	}
+}
+
+func TestShowProgress(t *testing.T) {
+	var out lockedBuffer
+	defer func(w io.Writer) { Progress = w }(Progress)
+	Progress = &out
+
+	token, done := startProgress("index")
+	showProgress(map[string]any{"progressToken": token, "progress": 3.0, "total": 4.0, "message": "files"})
+	// the progress of an unknown call is ignored
+	showProgress(map[string]any{"progressToken": "other", "progress": 1.0})
+	done()
+	if got := out.String(); got != "\r\033[Kindex: 75% files\r\033[K" {
+		t.Fatalf("unexpected progress %q", got)
+	}
+	// the calls of the same tool in flight, e.g. from two rounds, have their own tokens
+	first, doneFirst := startProgress("index")
+	defer doneFirst()
+	second, doneSecond := startProgress("index")
+	defer doneSecond()
+	if first == second {
+		t.Fatalf("the calls share the token %v", first)
+	}
+}
@@ -0,0 +1,261 @@
+package mcps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	mcpc "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// TokenDir is the folder where the OAuth clients and tokens of the servers are stored, they are kept in memory when it's empty.
+var TokenDir string
+
+// authorizationTimeout limits how long to wait for the user to sign in.
+const authorizationTimeout = 5 * time.Minute
+
+// OAuthConfig enables the OAuth authorization of a remote server.
+// The client is registered dynamically when ClientID is empty, the browser is opened to sign in,
+// and the code is received by a loopback server on CallbackPort, a free port is used when it's zero.
+type OAuthConfig struct {
+	ClientID     string   `yaml:"clientId,omitempty" json:"clientId,omitempty"`
+	ClientSecret string   `yaml:"clientSecret,omitempty" json:"clientSecret,omitempty"`
+	Scopes       []string `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+	CallbackPort int      `yaml:"callbackPort,omitempty" json:"callbackPort,omitempty"`
+}
+
+// openBrowser opens the url with the default browser, it's replaced in tests.
+var openBrowser = func(u string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", u).Start()
+	case "darwin":
+		return exec.Command("open", u).Start()
+	default:
+		return exec.Command("xdg-open", u).Start()
+	}
+}
+
+// oauthState is what is stored for a server: the registered client and its token.
+type oauthState struct {
+	// URL is the url of the server, the state of another url is not used.
+	URL          string           `json:"url"`
+	ClientID     string           `json:"client_id,omitempty"`
+	ClientSecret string           `json:"client_secret,omitempty"`
+	RedirectURI  string           `json:"redirect_uri,omitempty"`
+	Token        *transport.Token `json:"token,omitempty"`
+}
+
+// tokenStore implements transport.TokenStore, the state is saved to a file of TokenDir.
+type tokenStore struct {
+	path  string
+	mu    sync.Mutex
+	state oauthState
+}
+
+var invalidFileName = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// newTokenStore loads the stored state of the server.
+func newTokenStore(name string, serverURL string) *tokenStore {
+	s := &tokenStore{state: oauthState{URL: serverURL}}
+	if TokenDir == "" {
+		return s
+	}
+	s.path = filepath.Join(TokenDir, invalidFileName.ReplaceAllString(name, "_")+".json")
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return s
+	}
+	var state oauthState
+	if err := json.Unmarshal(data, &state); err != nil || state.URL != serverURL {
+		slog.Debug("stored oauth state is not used", "server", name, "error", err)
+		return s
+	}
+	s.state = state
+	return s
+}
+
+// GetToken implements transport.TokenStore.
+func (s *tokenStore) GetToken(ctx context.Context) (*transport.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.Token == nil {
+		return nil, transport.ErrNoToken
+	}
+	return s.state.Token, nil
+}
+
+// SaveToken implements transport.TokenStore.
+func (s *tokenStore) SaveToken(ctx context.Context, token *transport.Token) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Token = token
+	return s.save()
+}
+
+// saveClient stores the registered client, the stored token is dropped as it belongs to the previous client.
+func (s *tokenStore) saveClient(clientID, clientSecret, redirectURI string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.ClientID = clientID
+	s.state.ClientSecret = clientSecret
+	s.state.RedirectURI = redirectURI
+	s.state.Token = nil
+	return s.save()
+}
+
+func (s *tokenStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// oauthFlow authorizes a server with the authorization code flow and PKCE.
+type oauthFlow struct {
+	name        string
+	store       *tokenStore
+	redirectURI string
+}
+
+// newOAuthFlow prepares the authorization of a server, the redirect uri of a registered client is reused.
+func newOAuthFlow(name string, serverURL string, conf *OAuthConfig) (*oauthFlow, transport.OAuthConfig, error) {
+	store := newTokenStore(name, serverURL)
+	clientID, clientSecret, redirectURI := conf.ClientID, conf.ClientSecret, ""
+	if clientID == "" {
+		clientID, clientSecret, redirectURI = store.state.ClientID, store.state.ClientSecret, store.state.RedirectURI
+	}
+	if redirectURI == "" {
+		port := conf.CallbackPort
+		if port == 0 {
+			var err error
+			if port, err = freePort(); err != nil {
+				return nil, transport.OAuthConfig{}, err
+			}
+		}
+		redirectURI = "http://127.0.0.1:" + strconv.Itoa(port) + "/callback"
+	}
+	flow := &oauthFlow{name: name, store: store, redirectURI: redirectURI}
+	return flow, transport.OAuthConfig{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		Scopes:       conf.Scopes,
+		TokenStore:   store,
+		PKCEEnabled:  true,
+	}, nil
+}
+
+// freePort returns a free port of the loopback interface.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// authorize registers the client if needed, opens the browser to sign in, and exchanges the code received by the callback for a token.
+func (f *oauthFlow) authorize(ctx context.Context, handler *transport.OAuthHandler) error {
+	if handler == nil {
+		return errors.New("no oauth handler")
+	}
+	if handler.GetClientID() == "" {
+		if err := handler.RegisterClient(ctx, "gpt"); err != nil {
+			return fmt.Errorf("register oauth client of %s: %w", f.name, err)
+		}
+		if err := f.store.saveClient(handler.GetClientID(), handler.GetClientSecret(), f.redirectURI); err != nil {
+			slog.Warn("failed to save oauth client", "server", f.name, "error", err)
+		}
+	}
+
+	verifier, err := mcpc.GenerateCodeVerifier()
+	if err != nil {
+		return err
+	}
+	state, err := mcpc.GenerateState()
+	if err != nil {
+		return err
+	}
+	authURL, err := handler.GetAuthorizationURL(ctx, state, mcpc.GenerateCodeChallenge(verifier))
+	if err != nil {
+		return fmt.Errorf("authorization url of %s: %w", f.name, err)
+	}
+
+	redirect, err := url.Parse(f.redirectURI)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return fmt.Errorf("listen on the oauth callback %s: %w", redirect.Host, err)
+	}
+	type callback struct {
+		code, state, err string
+	}
+	callbacks := make(chan callback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirect.Path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		select {
+		case callbacks <- callback{code: q.Get("code"), state: q.Get("state"), err: q.Get("error")}:
+		default:
+		}
+		if q.Get("error") != "" {
+			fmt.Fprintf(w, "authorization of %s failed: %s, you can close this window.\n", f.name, q.Get("error"))
+			return
+		}
+		fmt.Fprintf(w, "%s is authorized, you can close this window.\n", f.name)
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	fmt.Fprintf(os.Stderr, "open this url to authorize %s:\n%s\n", f.name, authURL)
+	if err := openBrowser(authURL); err != nil {
+		slog.Debug("failed to open the browser", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authorizationTimeout)
+	defer cancel()
+	select {
+	case cb := <-callbacks:
+		if cb.err != "" {
+			return fmt.Errorf("authorization of %s failed: %s", f.name, cb.err)
+		}
+		if err := handler.ProcessAuthorizationResponse(ctx, cb.code, cb.state, verifier); err != nil {
+			return fmt.Errorf("authorization of %s failed: %w", f.name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("authorization of %s: %w", f.name, ctx.Err())
+	}
+}
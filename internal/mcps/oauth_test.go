@@ -0,0 +1,192 @@
+package mcps
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// fakeAuthServer is a MCP server protected by a fake OAuth authorization server.
+type fakeAuthServer struct {
+	mu         sync.Mutex
+	challenges map[string]string
+	issued     int
+	valid      map[string]bool
+	registered int
+	refreshed  int
+}
+
+func newFakeAuthServer(t *testing.T) (*fakeAuthServer, *httptest.Server) {
+	f := &fakeAuthServer{challenges: map[string]string{}, valid: map[string]bool{}}
+	s := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("ping"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+	mcpHandler := server.NewStreamableHTTPServer(s)
+
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"registration_endpoint":  srv.URL + "/register",
+		})
+	})
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.registered++
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"client_id": "client-1"})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != "client-1" || q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.challenges["code-1"] = q.Get("code_challenge")
+		f.mu.Unlock()
+		redirect, _ := url.Parse(q.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {"code-1"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+			if f.challenges[r.Form.Get("code")] != base64.RawURLEncoding.EncodeToString(sum[:]) {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			f.refreshed++
+		}
+		f.issued++
+		token := "token-" + strconv.Itoa(f.issued)
+		f.valid[token] = true
+		json.NewEncoder(w).Encode(map[string]any{"access_token": token, "token_type": "bearer", "refresh_token": "refresh", "expires_in": 3600})
+	})
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		f.mu.Lock()
+		ok := f.valid[token]
+		f.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mcpHandler.ServeHTTP(w, r)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func TestOAuthFlow(t *testing.T) {
+	TokenDir = t.TempDir()
+	defer func() { TokenDir = "" }()
+	f, srv := newFakeAuthServer(t)
+
+	browsed := 0
+	browser := openBrowser
+	defer func() { openBrowser = browser }()
+	openBrowser = func(u string) error {
+		browsed++
+		// the user signs in, the authorization server redirects to the callback
+		go http.Get(u)
+		return nil
+	}
+
+	servers := map[string]ServerConfig{"secure": {URL: srv.URL + "/mcp", OAuth: &OAuthConfig{}}}
+	start := func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		m, err := New(ctx, servers, "secure")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Shutdown()
+		if names := m.ToolNames(); len(names) != 1 || names[0] != "ping" {
+			t.Fatalf("unexpected tools %v", names)
+		}
+	}
+
+	start()
+	if browsed != 1 || f.registered != 1 {
+		t.Fatalf("expected one authorization, browsed %d registered %d", browsed, f.registered)
+	}
+	var state oauthState
+	data, err := os.ReadFile(filepath.Join(TokenDir, "secure.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil || state.ClientID != "client-1" || state.Token == nil || state.Token.AccessToken != "token-1" {
+		t.Fatalf("unexpected stored state %s", data)
+	}
+
+	// the stored token is used without signing in again
+	start()
+	if browsed != 1 || f.registered != 1 {
+		t.Fatalf("expected the stored token used, browsed %d registered %d", browsed, f.registered)
+	}
+
+	// an expired token is refreshed
+	state.Token.ExpiresAt = time.Now().Add(-time.Minute)
+	data, _ = json.Marshal(state)
+	if err := os.WriteFile(filepath.Join(TokenDir, "secure.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	start()
+	if browsed != 1 || f.refreshed != 1 {
+		t.Fatalf("expected the token refreshed, browsed %d refreshed %d", browsed, f.refreshed)
+	}
+}
+
+func TestOAuthDenied(t *testing.T) {
+	_, srv := newFakeAuthServer(t)
+	flow, conf, err := newOAuthFlow("denied", srv.URL+"/mcp", &OAuthConfig{ClientID: "client-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := transport.NewOAuthHandler(conf)
+	handler.SetBaseURL(srv.URL)
+
+	browser := openBrowser
+	defer func() { openBrowser = browser }()
+	openBrowser = func(u string) error {
+		go http.Get(flow.redirectURI + "?error=access_denied")
+		return nil
+	}
+
+	err = flow.authorize(context.Background(), handler)
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("expected the denied authorization, got %v", err)
+	}
+}
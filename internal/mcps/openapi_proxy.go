@@ -21,6 +21,8 @@ type OpenApiMcpClient struct {
 	doc    libopenapi.Document
 	model  *v3.Document
 	client *http.Client
+	// notifier reports the progress of the requests
+	notifier notifier
 }
 
 // NewOpenApiMcpClient creates a new OpenApiMcpClient from a configuration file.
@@ -260,7 +262,7 @@ func (p *OpenApiMcpClient) CallTool(
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := p.client.Do(req)
+	resp, err := p.notifier.do(p.client, req, request.Params.Meta)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
@@ -312,7 +314,8 @@ func (p *OpenApiMcpClient) ListResources(
 	ctx context.Context,
 	request mcp.ListResourcesRequest,
 ) (*mcp.ListResourcesResult, error) {
-	return nil, fmt.Errorf("not implemented")
+	// the operations are published as tools, there are no resources
+	return &mcp.ListResourcesResult{Resources: []mcp.Resource{}}, nil
 }
 
 // ListResourcesByPage implements the MCPClient.ListResourcesByPage method.
@@ -328,7 +331,7 @@ func (p *OpenApiMcpClient) ListResourceTemplates(
 	ctx context.Context,
 	request mcp.ListResourceTemplatesRequest,
 ) (*mcp.ListResourceTemplatesResult, error) {
-	return nil, fmt.Errorf("not implemented")
+	return &mcp.ListResourceTemplatesResult{ResourceTemplates: []mcp.ResourceTemplate{}}, nil
 }
 
 // ListResourceTemplatesByPage implements the MCPClient.ListResourceTemplatesByPage method.
@@ -344,7 +347,7 @@ func (p *OpenApiMcpClient) ReadResource(
 	ctx context.Context,
 	request mcp.ReadResourceRequest,
 ) (*mcp.ReadResourceResult, error) {
-	return nil, fmt.Errorf("not implemented")
+	return nil, fmt.Errorf("resource not found: %s", request.Params.URI)
 }
 
 // Subscribe implements the MCPClient.Subscribe method.
@@ -377,4 +380,5 @@ func (p *OpenApiMcpClient) Close() error {
 
 // OnNotification implements the MCPClient.OnNotification method.
 func (p *OpenApiMcpClient) OnNotification(handler func(notification mcp.JSONRPCNotification)) {
+	p.notifier.add(handler)
 }
@@ -0,0 +1,55 @@
+package mcps
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// aliveInGroup returns the pids of the processes in the process group which are not zombies.
+func aliveInGroup(t *testing.T, pgid int) []string {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alive []string
+	for _, stat := range stats {
+		body, err := os.ReadFile(stat)
+		if err != nil {
+			continue
+		}
+		// the fields after the command are: state ppid pgrp
+		fields := strings.Fields(string(body[strings.LastIndexByte(string(body), ')')+1:]))
+		if len(fields) < 3 || fields[2] != strconv.Itoa(pgid) || fields[0] == "Z" {
+			continue
+		}
+		alive = append(alive, filepath.Base(filepath.Dir(stat)))
+	}
+	return alive
+}
+
+func TestCloseKillsChildren(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "server.sh")
+	// the server ignores its stdin and leaves a child behind
+	if err := os.WriteFile(script, []byte("sleep 60 &\nsleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewLocalClient(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgid := c.cmd.Process.Pid
+
+	start := time.Now()
+	c.Close()
+	if elapsed := time.Since(start); elapsed > 3*shutdownGrace {
+		t.Fatalf("close takes too long: %s", elapsed)
+	}
+	if alive := aliveInGroup(t, pgid); len(alive) > 0 {
+		t.Fatalf("children are still alive: %v", alive)
+	}
+}
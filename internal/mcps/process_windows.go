@@ -0,0 +1,19 @@
+//go:build windows
+
+package mcps
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup does nothing on windows, the children are found by taskkill.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessTree kills the process of the command with its children.
+func killProcessTree(cmd *exec.Cmd) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
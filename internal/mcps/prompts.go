@@ -2,6 +2,7 @@ package mcps
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
@@ -21,13 +22,45 @@ func GetPrompt(name string) (string, bool) {
 	return value.(string), true
 }
 
-// updateMcpPrompt updates the MCP prompts from the given client.
-func updateMcpPrompt(client mcpc.MCPClient) {
-	ctx := context.Background()
+// PromptInfo is a prompt of a server, Server is the name of the server.
+type PromptInfo struct {
+	Server string     `json:"server"`
+	Prompt mcp.Prompt `json:"prompt"`
+}
+
+// Prompts lists the prompts of all the MCP servers, a server without prompts is skipped.
+func (m *MCPs) Prompts(ctx context.Context) ([]PromptInfo, error) {
+	infos := make([]PromptInfo, 0)
+	for _, client := range m.clients {
+		if err := client.ensureStarted(ctx); err != nil {
+			return nil, fmt.Errorf("failed to start mcp server %s: %w", client.name, err)
+		}
+		list, err := client.client.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			slog.Debug("failed to list prompts", "provider", client.provider, "error", err)
+			continue
+		}
+		for _, prompt := range list.Prompts {
+			infos = append(infos, PromptInfo{Server: client.name, Prompt: prompt})
+		}
+	}
+	return infos, nil
+}
+
+// storePrompts makes the prompts of a server available by GetPrompt.
+func storePrompts(prompts map[string]string) {
+	for name, body := range prompts {
+		mcpPrompts.Store(name, body)
+	}
+}
+
+// listPrompts gets the prompts of the given client, a prompt is the text of its messages.
+func listPrompts(ctx context.Context, client mcpc.MCPClient) map[string]string {
+	prompts := make(map[string]string)
 	lists, err := client.ListPrompts(ctx, mcp.ListPromptsRequest{})
 	if err != nil {
 		slog.Warn("Failed to list MCP prompts", "error", err)
-		return
+		return prompts
 	}
 	for _, prompt := range lists.Prompts {
 		promptContent, err := client.GetPrompt(ctx, mcp.GetPromptRequest{
@@ -45,7 +78,8 @@ func updateMcpPrompt(client mcpc.MCPClient) {
 			}
 		}
 		body := strings.Join(messages, "\n")
-		slog.Debug("Update MCP prompt", "name", prompt.Name, "body", body[0:100])
-		mcpPrompts.Store(prompt.Name, body)
+		slog.Debug("Update MCP prompt", "name", prompt.Name, "size", len(body))
+		prompts[prompt.Name] = body
 	}
+	return prompts
 }
@@ -3,6 +3,7 @@ package mcps
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,9 +13,11 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/goccy/go-yaml"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/yosida95/uritemplate/v3"
 )
 
 // PromptDef defines the structure of a prompt in the proxy configuration.
@@ -33,11 +36,28 @@ type ToolDef struct {
 	InputSchema mcp.ToolInputSchema `json:"inputSchema,omitempty" yaml:"inputSchema,omitempty"`
 }
 
+// ResourceDef defines the structure of a resource in the proxy configuration, it's read by a HTTP GET of its URL.
+// A URI with '{var}' placeholders is a resource template, the values matched from a URI are expanded in the URL.
+type ResourceDef struct {
+	URI         string `json:"uri" yaml:"uri"`
+	Name        string `json:"name" yaml:"name"`
+	URL         string `json:"url" yaml:"url"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty" yaml:"mimeType,omitempty"`
+}
+
+// isTemplate reports whether the resource is a resource template.
+func (r *ResourceDef) isTemplate() bool {
+	return strings.Contains(r.URI, "{")
+}
+
 // ProxyMCPClient implements the MCPClient interface and proxies HTTP services as MCP services.
 type ProxyMCPClient struct {
-	Tools      []ToolDef    `json:"tools" yaml:"tools"`
-	Prompts    []PromptDef  `json:"prompts" yaml:"prompts"`
-	httpClient *http.Client `json:"-" yaml:"-"`
+	Tools      []ToolDef     `json:"tools" yaml:"tools"`
+	Prompts    []PromptDef   `json:"prompts" yaml:"prompts"`
+	Resources  []ResourceDef `json:"resources" yaml:"resources"`
+	httpClient *http.Client  `json:"-" yaml:"-"`
+	notifier   notifier
 }
 
 // NewProxyMCPClient creates a new ProxyMCPClient from a configuration file.
@@ -48,6 +68,15 @@ func NewProxyMCPClient(configPath string) (*ProxyMCPClient, error) {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	for _, resource := range client.Resources {
+		if _, err := uritemplate.New(resource.URI); err != nil {
+			return nil, fmt.Errorf("invalid uri of resource %s: %w", resource.Name, err)
+		}
+		if _, err := uritemplate.New(resource.URL); err != nil {
+			return nil, fmt.Errorf("invalid url of resource %s: %w", resource.Name, err)
+		}
+	}
+
 	client.httpClient = &http.Client{}
 
 	return client, nil
@@ -104,10 +133,22 @@ func (p *ProxyMCPClient) Initialize(
 			Name:    "ProxyMCP",
 			Version: "1.0.0",
 		},
-		Capabilities: mcp.ServerCapabilities{},
+		Capabilities: p.capabilities(),
 	}, nil
 }
 
+// capabilities returns the capabilities of the proxy, resources are announced when there are any.
+func (p *ProxyMCPClient) capabilities() mcp.ServerCapabilities {
+	capabilities := mcp.ServerCapabilities{}
+	if len(p.Resources) > 0 {
+		capabilities.Resources = &struct {
+			Subscribe   bool `json:"subscribe,omitempty"`
+			ListChanged bool `json:"listChanged,omitempty"`
+		}{}
+	}
+	return capabilities
+}
+
 // Ping implements the MCPClient.Ping method.
 func (p *ProxyMCPClient) Ping(ctx context.Context) error {
 	// 对于代理客户端，ping 总是成功的
@@ -165,7 +206,7 @@ func asQSValue(v any) string {
 	}
 }
 
-func toolRequest(tool *ToolDef, callRequest *mcp.CallToolRequest) (*http.Request, error) {
+func toolRequest(ctx context.Context, tool *ToolDef, callRequest *mcp.CallToolRequest) (*http.Request, error) {
 
 	parsedURL, err := url.Parse(tool.URL)
 	if err != nil {
@@ -192,11 +233,7 @@ func toolRequest(tool *ToolDef, callRequest *mcp.CallToolRequest) (*http.Request
 		}
 	}
 
-	return &http.Request{
-		Method: tool.Method,
-		URL:    parsedURL,
-		Body:   io.NopCloser(body),
-	}, nil
+	return http.NewRequestWithContext(ctx, tool.Method, parsedURL.String(), body)
 }
 
 // CallTool implements the MCPClient.CallTool method.
@@ -217,13 +254,13 @@ func (p *ProxyMCPClient) CallTool(
 		return nil, fmt.Errorf("tool not found: %s", request.Params.Name)
 	}
 
-	req, err := toolRequest(toolDef, &request)
+	req, err := toolRequest(ctx, toolDef, &request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tool request: %w", err)
 	}
 
 	// 发送请求
-	resp, err := p.httpClient.Do(req)
+	resp, err := p.notifier.do(p.httpClient, req, request.Params.Meta)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
@@ -316,7 +353,20 @@ func (p *ProxyMCPClient) ListResources(
 	ctx context.Context,
 	request mcp.ListResourcesRequest,
 ) (*mcp.ListResourcesResult, error) {
-	return nil, fmt.Errorf("resource listing not implemented for proxy client")
+	resources := make([]mcp.Resource, 0, len(p.Resources))
+	for _, resourceDef := range p.Resources {
+		if resourceDef.isTemplate() {
+			continue
+		}
+		resources = append(resources, mcp.NewResource(resourceDef.URI, resourceDef.Name,
+			mcp.WithResourceDescription(resourceDef.Description),
+			mcp.WithMIMEType(resourceDef.MimeType),
+		))
+	}
+
+	return &mcp.ListResourcesResult{
+		Resources: resources,
+	}, nil
 }
 
 // ListResourcesByPage implements the MCPClient.ListResourcesByPage method.
@@ -332,7 +382,20 @@ func (p *ProxyMCPClient) ListResourceTemplates(
 	ctx context.Context,
 	request mcp.ListResourceTemplatesRequest,
 ) (*mcp.ListResourceTemplatesResult, error) {
-	return nil, fmt.Errorf("resource templates not implemented for proxy client")
+	templates := make([]mcp.ResourceTemplate, 0, len(p.Resources))
+	for _, resourceDef := range p.Resources {
+		if !resourceDef.isTemplate() {
+			continue
+		}
+		templates = append(templates, mcp.NewResourceTemplate(resourceDef.URI, resourceDef.Name,
+			mcp.WithTemplateDescription(resourceDef.Description),
+			mcp.WithTemplateMIMEType(resourceDef.MimeType),
+		))
+	}
+
+	return &mcp.ListResourceTemplatesResult{
+		ResourceTemplates: templates,
+	}, nil
 }
 
 // ListResourceTemplatesByPage implements the MCPClient.ListResourceTemplatesByPage method.
@@ -343,12 +406,70 @@ func (p *ProxyMCPClient) ListResourceTemplatesByPage(
 	return p.ListResourceTemplates(ctx, request)
 }
 
+// resourceURL returns the definition of a resource URI and the URL to read it.
+func (p *ProxyMCPClient) resourceURL(uri string) (*ResourceDef, string, error) {
+	for i := range p.Resources {
+		resourceDef := &p.Resources[i]
+		if resourceDef.URI == uri {
+			return resourceDef, resourceDef.URL, nil
+		}
+	}
+	for i := range p.Resources {
+		resourceDef := &p.Resources[i]
+		if !resourceDef.isTemplate() {
+			continue
+		}
+		values := uritemplate.MustNew(resourceDef.URI).Match(uri)
+		if values == nil {
+			continue
+		}
+		resourceURL, err := uritemplate.MustNew(resourceDef.URL).Expand(values)
+		return resourceDef, resourceURL, err
+	}
+	return nil, "", fmt.Errorf("resource not found: %s", uri)
+}
+
 // ReadResource implements the MCPClient.ReadResource method.
 func (p *ProxyMCPClient) ReadResource(
 	ctx context.Context,
 	request mcp.ReadResourceRequest,
 ) (*mcp.ReadResourceResult, error) {
-	return nil, fmt.Errorf("resource reading not implemented for proxy client")
+	resourceDef, resourceURL, err := p.resourceURL(request.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource request: %w", err)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP Error %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	mimeType := resourceDef.MimeType
+	if mimeType == "" {
+		mimeType = resp.Header.Get("Content-Type")
+	}
+	var contents mcp.ResourceContents
+	if utf8.Valid(respBody) {
+		contents = mcp.TextResourceContents{URI: request.Params.URI, MIMEType: mimeType, Text: string(respBody)}
+	} else {
+		contents = mcp.BlobResourceContents{URI: request.Params.URI, MIMEType: mimeType, Blob: base64.StdEncoding.EncodeToString(respBody)}
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []mcp.ResourceContents{contents},
+	}, nil
 }
 
 // Subscribe implements the MCPClient.Subscribe method.
@@ -386,4 +507,5 @@ func (p *ProxyMCPClient) Close() error {
 
 // OnNotification implements the MCPClient.OnNotification method.
 func (p *ProxyMCPClient) OnNotification(handler func(notification mcp.JSONRPCNotification)) {
+	p.notifier.add(handler)
 }
@@ -0,0 +1,115 @@
+package mcps
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// resourceServers are the running clients which provide resources, '@mcp:<uri>' of a prompt is read from them.
+var resourceServers = struct {
+	sync.Mutex
+	clients []*McpClient
+}{}
+
+// registerResources makes the resources of the clients readable by ReadResource.
+func registerResources(clients ...*McpClient) {
+	resourceServers.Lock()
+	defer resourceServers.Unlock()
+	resourceServers.clients = append(resourceServers.clients, clients...)
+}
+
+// unregisterResources removes the clients which are shut down.
+func unregisterResources(clients ...*McpClient) {
+	resourceServers.Lock()
+	defer resourceServers.Unlock()
+	resourceServers.clients = slices.DeleteFunc(resourceServers.clients, func(c *McpClient) bool {
+		return slices.Contains(clients, c)
+	})
+}
+
+// listResources lists the resources and resource templates of a client, it's skipped when the server has no resources.
+func (c *McpClient) listResources(ctx context.Context, capabilities mcp.ServerCapabilities) ([]mcp.Resource, []mcp.ResourceTemplate, error) {
+	if capabilities.Resources == nil {
+		return nil, nil, nil
+	}
+	resources, err := c.client.ListResources(ctx, mcp.ListResourcesRequest{})
+	if err != nil {
+		return nil, nil, err
+	}
+	templates, err := c.client.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{})
+	if err != nil {
+		// templates are optional, some servers do not implement the method
+		slog.Debug("failed to list resource templates", "provider", c.provider, "error", err)
+		return resources.Resources, nil, nil
+	}
+	return resources.Resources, templates.ResourceTemplates, nil
+}
+
+// hasResource reports whether the client lists the uri, or has a template which matches it.
+func (c *McpClient) hasResource(uri string) bool {
+	for _, resource := range c.resources {
+		if resource.URI == uri {
+			return true
+		}
+	}
+	for _, template := range c.templates {
+		if template.URITemplate != nil && template.URITemplate.Template != nil && template.URITemplate.Match(uri) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadResource reads a resource of the running MCP servers and returns its text.
+func ReadResource(ctx context.Context, uri string) (string, error) {
+	resourceServers.Lock()
+	clients := slices.Clone(resourceServers.clients)
+	resourceServers.Unlock()
+
+	for _, client := range clients {
+		if !client.hasResource(uri) {
+			continue
+		}
+		if err := client.ensureStarted(ctx); err != nil {
+			return "", fmt.Errorf("read resource %s: %w", uri, err)
+		}
+		result, err := client.client.ReadResource(ctx, mcp.ReadResourceRequest{
+			Params: mcp.ReadResourceParams{URI: uri},
+		})
+		if err != nil {
+			return "", fmt.Errorf("read resource %s: %w", uri, err)
+		}
+		return resourceText(uri, result.Contents)
+	}
+	return "", fmt.Errorf("resource not found: %s", uri)
+}
+
+// resourceText joins the text contents of a resource, a binary content is used only when it's valid UTF-8 text.
+func resourceText(uri string, contents []mcp.ResourceContents) (string, error) {
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch content := content.(type) {
+		case mcp.TextResourceContents:
+			texts = append(texts, content.Text)
+		case mcp.BlobResourceContents:
+			data, err := base64.StdEncoding.DecodeString(content.Blob)
+			if err != nil || !utf8.Valid(data) {
+				slog.Warn("binary resource content is skipped", "uri", content.URI, "mimeType", content.MIMEType)
+				continue
+			}
+			texts = append(texts, string(data))
+		}
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("resource %s has no text content", uri)
+	}
+	return strings.Join(texts, "\n"), nil
+}
@@ -0,0 +1,63 @@
+package mcps
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxyResources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readme":
+			w.Write([]byte("read me"))
+		case "/ip":
+			w.Write([]byte("ip " + r.URL.Query().Get("ip")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "test.mcp.yaml")
+	err := os.WriteFile(config, []byte(`
+resources:
+  - uri: "docs://readme"
+    name: "readme"
+    url: "`+srv.URL+`/readme"
+  - uri: "ip://{ip}"
+    name: "ip"
+    url: "`+srv.URL+`/ip{?ip}"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	s, err := New(ctx, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, templates := s.Resources()
+	if len(resources) != 1 || resources[0].URI != "docs://readme" || len(templates) != 1 || templates[0].URITemplate.Raw() != "ip://{ip}" {
+		t.Fatalf("unexpected resources %+v %+v", resources, templates)
+	}
+
+	if text, err := ReadResource(ctx, "docs://readme"); err != nil || text != "read me" {
+		t.Fatalf("unexpected resource %q %v", text, err)
+	}
+	if text, err := ReadResource(ctx, "ip://1.2.3.4"); err != nil || text != "ip 1.2.3.4" {
+		t.Fatalf("unexpected templated resource %q %v", text, err)
+	}
+	if _, err := ReadResource(ctx, "docs://missing"); err == nil {
+		t.Fatal("expected an error for an unknown resource")
+	}
+
+	s.Shutdown()
+	if _, err := ReadResource(ctx, "docs://readme"); err == nil {
+		t.Fatal("expected the resources removed on shutdown")
+	}
+}
@@ -0,0 +1,40 @@
+package mcps
+
+import (
+	"context"
+
+	mcpc "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Sampler answers the sampling requests of the servers with a model, server is the name of the server which asks.
+type Sampler interface {
+	Sample(ctx context.Context, server string, req mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+}
+
+// Sampling answers the sampling requests of the servers started after it's set, the servers can not sample when it's nil.
+var Sampling Sampler
+
+// samplingHandler passes the sampling requests of a client to Sampling with the name of its server.
+type samplingHandler struct {
+	client  *McpClient
+	sampler Sampler
+}
+
+func (h *samplingHandler) CreateMessage(ctx context.Context, req mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	// the name is given after the server is initialized
+	name := h.client.name
+	if name == "" {
+		name = serverName(h.client.provider)
+	}
+	return h.sampler.Sample(ctx, name, req)
+}
+
+// enableSampling declares the sampling capability of the client when Sampling is set, it must be called before initialize.
+func (c *McpClient) enableSampling() {
+	client, ok := c.client.(*mcpc.Client)
+	if !ok || Sampling == nil {
+		return
+	}
+	mcpc.WithSamplingHandler(&samplingHandler{client: c, sampler: Sampling})(client)
+}
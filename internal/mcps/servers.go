@@ -0,0 +1,140 @@
+package mcps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ServerConfig configures a MCP server by name, the fields follow the 'mcpServers' layout of mcp.json used by other clients.
+// Type is "stdio", "http" or "sse", it's "stdio" when Command is set, otherwise it's guessed from URL.
+// The values of Env, Headers and Bearer can refer to environment variables as ${NAME}.
+// Bearer is sent as the Authorization header, OAuth enables the OAuth authorization of a remote server.
+// Timeout limits the start of the server, e.g. "1m", it overrides StartTimeout.
+// A server which fails to start is skipped with a warning, unless Required is set.
+type ServerConfig struct {
+	Type     string            `yaml:"type,omitempty" json:"type,omitempty"`
+	Command  string            `yaml:"command,omitempty" json:"command,omitempty"`
+	Args     []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Cwd      string            `yaml:"cwd,omitempty" json:"cwd,omitempty"`
+	URL      string            `yaml:"url,omitempty" json:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Bearer   string            `yaml:"bearer,omitempty" json:"bearer,omitempty"`
+	OAuth    *OAuthConfig      `yaml:"oauth,omitempty" json:"oauth,omitempty"`
+	Timeout  string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Required bool              `yaml:"required,omitempty" json:"required,omitempty"`
+}
+
+// serversFile is the layout of a mcp.json file, some clients name the map 'servers'.
+type serversFile struct {
+	MCPServers map[string]ServerConfig `yaml:"mcpServers" json:"mcpServers"`
+	Servers    map[string]ServerConfig `yaml:"servers" json:"servers"`
+}
+
+// transport returns the transport of the server, stdio, http or sse.
+func (s *ServerConfig) transport() (string, error) {
+	switch strings.ToLower(s.Type) {
+	case "":
+		if s.Command != "" {
+			return "stdio", nil
+		}
+		if s.URL != "" {
+			if strings.Contains(s.URL, "sse") {
+				return "sse", nil
+			}
+			return "http", nil
+		}
+		return "", fmt.Errorf("either command or url is required")
+	case "stdio":
+		if s.Command == "" {
+			return "", fmt.Errorf("command is required by the stdio transport")
+		}
+		return "stdio", nil
+	case "http", "streamable-http", "streamablehttp":
+		if s.URL == "" {
+			return "", fmt.Errorf("url is required by the http transport")
+		}
+		return "http", nil
+	case "sse":
+		if s.URL == "" {
+			return "", fmt.Errorf("url is required by the sse transport")
+		}
+		return "sse", nil
+	default:
+		return "", fmt.Errorf("unknown transport type %s", s.Type)
+	}
+}
+
+// NewServerClient starts the configured server of the name.
+func NewServerClient(ctx context.Context, name string, conf ServerConfig) (*McpClient, error) {
+	client, err := newServerClient(ctx, name, conf)
+	if err != nil {
+		return nil, err
+	}
+	client.name = invalidName.ReplaceAllString(name, "_")
+	return client, nil
+}
+
+func newServerClient(ctx context.Context, name string, conf ServerConfig) (*McpClient, error) {
+	transport, err := conf.transport()
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s: %w", name, err)
+	}
+	if transport == "stdio" {
+		env := make([]string, 0, len(conf.Env))
+		for k, v := range conf.Env {
+			env = append(env, k+"="+os.ExpandEnv(v))
+		}
+		return newStdioClient(name, conf.Command, conf.Args, env, conf.Cwd)
+	}
+	headers := make(map[string]string, len(conf.Headers)+1)
+	for k, v := range conf.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+	if conf.Bearer != "" {
+		headers["Authorization"] = "Bearer " + os.ExpandEnv(conf.Bearer)
+	}
+	return newRemoteClient(ctx, name, conf.URL, transport == "sse", headers, conf.OAuth)
+}
+
+// LoadServersFile reads the servers of a mcp.json file, it returns false when the file does not have the layout.
+func LoadServersFile(name string) (map[string]ServerConfig, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+		return nil, false
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	var file serversFile
+	if ext == ".json" {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, false
+	}
+	if file.MCPServers != nil {
+		return file.MCPServers, true
+	}
+	return file.Servers, file.Servers != nil
+}
+
+// serverNames returns the names of the servers in order, so they are started in the same order each time.
+func serverNames(servers map[string]ServerConfig) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
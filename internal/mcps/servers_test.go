@@ -0,0 +1,119 @@
+package mcps
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestServerTransport(t *testing.T) {
+	cases := []struct {
+		conf ServerConfig
+		want string
+	}{
+		{ServerConfig{Command: "npx"}, "stdio"},
+		{ServerConfig{URL: "http://localhost/mcp"}, "http"},
+		{ServerConfig{URL: "http://localhost/sse"}, "sse"},
+		{ServerConfig{Type: "streamable-http", URL: "http://localhost/events"}, "http"},
+		{ServerConfig{Type: "SSE", URL: "http://localhost/events"}, "sse"},
+		{ServerConfig{Type: "stdio"}, ""},
+		{ServerConfig{}, ""},
+	}
+	for _, c := range cases {
+		got, err := c.conf.transport()
+		if got != c.want || (err != nil) != (c.want == "") {
+			t.Errorf("transport of %+v = %q, %v, want %q", c.conf, got, err, c.want)
+		}
+	}
+}
+
+func TestLoadServersFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mcp.json")
+	err := os.WriteFile(file, []byte(`{"mcpServers": {"github": {"command": "npx", "args": ["-y", "server-github"], "env": {"TOKEN": "${GITHUB_TOKEN}"}}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, ok := LoadServersFile(file)
+	if !ok || servers["github"].Command != "npx" || len(servers["github"].Args) != 2 || servers["github"].Env["TOKEN"] != "${GITHUB_TOKEN}" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+
+	// a proxy configuration is not a servers file
+	proxy := filepath.Join(dir, "qqwry.mcp.json")
+	if err := os.WriteFile(proxy, []byte(`{"tools": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LoadServersFile(proxy); ok {
+		t.Fatal("expected the proxy configuration not loaded as servers")
+	}
+}
+
+func TestStdioServerEnvAndCwd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir := t.TempDir()
+	t.Setenv("GREETING_NAME", "world")
+	c, err := NewServerClient(context.Background(), "echo", ServerConfig{
+		Command: "sh",
+		Args:    []string{"-c", `echo "hello $GREETING" > out.txt`},
+		Env:     map[string]string{"GREETING": "${GREETING_NAME}"},
+		Cwd:     dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		body, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+		if err == nil && strings.TrimSpace(string(body)) == "hello world" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected output %q %v", body, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestNamedRemoteServer(t *testing.T) {
+	s := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("ping"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+	var auth string
+	mcpHandler := server.NewStreamableHTTPServer(s)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	t.Setenv("TEST_MCP_TOKEN", "secret")
+	servers := map[string]ServerConfig{
+		"remote": {URL: srv.URL + "/mcp", Headers: map[string]string{"Authorization": "Bearer ${TEST_MCP_TOKEN}"}},
+	}
+	m, err := New(context.Background(), servers, "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	if names := m.ToolNames(); len(names) != 1 || names[0] != "ping" {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if auth != "Bearer secret" {
+		t.Fatalf("unexpected authorization %q", auth)
+	}
+}
@@ -0,0 +1,163 @@
+package mcps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// StartTimeout limits the start of each server, including its initialization and the listing of its tools,
+// zero means no limit. The timeout of a server config overrides it.
+var StartTimeout = 30 * time.Second
+
+// serverStart is a server to start, conf is nil for a provider which is not configured.
+type serverStart struct {
+	name     string
+	provider string
+	conf     *ServerConfig
+}
+
+// serverStarts returns the servers of a provider: a configured server, the servers of a mcp.json file, or the provider itself.
+func (m *MCPs) serverStarts(provider string) []serverStart {
+	if conf, ok := m.servers[provider]; ok {
+		return []serverStart{{name: provider, provider: provider, conf: &conf}}
+	}
+	if servers, ok := LoadServersFile(provider); ok {
+		starts := make([]serverStart, 0, len(servers))
+		for _, name := range serverNames(servers) {
+			conf := servers[name]
+			starts = append(starts, serverStart{name: name, provider: name, conf: &conf})
+		}
+		return starts
+	}
+	return []serverStart{{provider: provider}}
+}
+
+// required reports whether the run fails when the server fails to start.
+func (s serverStart) required() bool {
+	return s.conf != nil && s.conf.Required
+}
+
+// timeout returns the context which limits the start of the server.
+// A server which authorizes by OAuth waits for the user to sign in, it's not limited unless it sets its own timeout.
+func (s serverStart) timeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	timeout := StartTimeout
+	if s.conf != nil && s.conf.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.conf.Timeout); err != nil {
+			return nil, nil, fmt.Errorf("invalid timeout of mcp server %s: %w", s.name, err)
+		}
+	} else if s.conf != nil && s.conf.OAuth != nil {
+		timeout = 0
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// connect starts the process of the server or connects to it.
+func (s serverStart) connect(ctx context.Context) (*McpClient, error) {
+	if s.conf != nil {
+		return NewServerClient(ctx, s.name, *s.conf)
+	}
+	return NewClient(ctx, s.provider)
+}
+
+// client returns the client of the server. A stdio server whose tools are cached is not started,
+// it's started when one of its tools is called, other servers are started and their tools are listed.
+// A required server is always started, so its failure is not hidden by the cache.
+func (s serverStart) client(ctx context.Context) (*McpClient, error) {
+	if !s.required() {
+		if client := s.cachedClient(); client != nil {
+			return client, nil
+		}
+	}
+	ctx, cancel, err := s.timeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := client.setup(ctx)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	client.tools = listed.Tools
+	client.resources = listed.Resources
+	client.templates = listed.Templates
+	storePrompts(listed.Prompts)
+	s.saveCache(listed)
+	return client, nil
+}
+
+// setup initializes the session of a started client, and lists the tools, the prompts and the resources of the server.
+func (c *McpClient) setup(ctx context.Context) (*serverLists, error) {
+	c.subscribe()
+	initResult, err := c.initialize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+	resp, err := c.client.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tools: %w", err)
+	}
+	listed := &serverLists{Tools: resp.Tools}
+	if initResult.Capabilities.Prompts != nil {
+		listed.Prompts = listPrompts(ctx, c.client)
+	}
+	if listed.Resources, listed.Templates, err = c.listResources(ctx, initResult.Capabilities); err != nil {
+		slog.Warn("failed to list resources", "provider", c.provider, "error", err)
+	}
+	return listed, nil
+}
+
+// ensureStarted starts the server of a client created from the cache, the client of a started server is returned as is.
+// The tools listed by the server are cached, and replace the cached ones at the next MCPs.Refresh when they differ.
+func (c *McpClient) ensureStarted(ctx context.Context) error {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	if c.lazy == nil {
+		return nil
+	}
+	ctx, cancel, err := c.lazy.timeout(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	started, err := c.lazy.connect(ctx)
+	if err != nil {
+		return err
+	}
+	c.client, c.cmd, c.startScript, c.oauth = started.client, started.cmd, started.startScript, started.oauth
+	listed, err := c.setup(ctx)
+	if err != nil {
+		c.close()
+		c.client = nil
+		return err
+	}
+	storePrompts(listed.Prompts)
+	c.lazy.saveCache(listed)
+	c.lazy = nil
+	if !sameTools(c.cachedTools, listed.Tools) {
+		c.toolsChanged.Store(true)
+	}
+	return nil
+}
+
+// sameTools reports whether the tools are the same in JSON.
+func sameTools(a, b []mcp.Tool) bool {
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && string(x) == string(y)
+}
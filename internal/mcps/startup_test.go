@@ -0,0 +1,148 @@
+package mcps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// TestMain runs the test binary as a stdio server when GPT_TEST_STDIO_SERVER is set,
+// each start is recorded as a line of the file GPT_TEST_STARTS.
+func TestMain(m *testing.M) {
+	if os.Getenv("GPT_TEST_STDIO_SERVER") == "" {
+		os.Exit(m.Run())
+	}
+	if f, err := os.OpenFile(os.Getenv("GPT_TEST_STARTS"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+		f.WriteString("start\n")
+		f.Close()
+	}
+	s := server.NewMCPServer("stdio", "1.0.0")
+	s.AddTool(mcp.NewTool("echo"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("echo"), nil
+	})
+	server.ServeStdio(s)
+	os.Exit(0)
+}
+
+// stdioServer configures the test binary as a stdio server, it returns the function counting its starts.
+func stdioServer(t *testing.T) (ServerConfig, func() int) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := t.TempDir() + "/starts"
+	conf := ServerConfig{
+		Command: exe,
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{"GPT_TEST_STDIO_SERVER": "1", "GPT_TEST_STARTS": starts},
+	}
+	return conf, func() int {
+		data, _ := os.ReadFile(starts)
+		return strings.Count(string(data), "start")
+	}
+}
+
+func TestStartSkipsFailedServers(t *testing.T) {
+	stdio, _ := stdioServer(t)
+	servers := map[string]ServerConfig{
+		"stdio":   stdio,
+		"missing": {Command: "/not/exist/server"},
+		"hung":    {Command: "sleep", Args: []string{"60"}, Timeout: "200ms"},
+		"needed":  {Command: "/not/exist/server", Required: true},
+	}
+	ctx := context.Background()
+
+	start := time.Now()
+	m, err := New(ctx, servers, "stdio", "missing", "hung")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	if names := m.ToolNames(); len(names) != 1 || names[0] != "echo" {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if elapsed := time.Since(start); elapsed > StartTimeout/2 {
+		t.Fatalf("the hung server is not timed out: %s", elapsed)
+	}
+
+	if _, err := New(ctx, servers, "stdio", "needed"); err == nil || !strings.Contains(err.Error(), "needed") {
+		t.Fatalf("expected the required server fails, got %v", err)
+	}
+	if err := m.Add(ctx, "needed"); err == nil {
+		t.Fatal("expected the required server fails")
+	}
+	if names := m.ToolNames(); len(names) != 1 {
+		t.Fatalf("unexpected tools %v", names)
+	}
+}
+
+func TestLazyStartFromCache(t *testing.T) {
+	dir := CacheDir
+	defer func() { CacheDir = dir }()
+	CacheDir = t.TempDir()
+
+	stdio, starts := stdioServer(t)
+	stdio.Env["GPT_TEST_TOKEN"] = "secret-token"
+	servers := map[string]ServerConfig{"stdio": stdio}
+	ctx := context.Background()
+
+	m, err := New(ctx, servers, "stdio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Shutdown()
+	if starts() != 1 {
+		t.Fatalf("expected the server started once, got %d", starts())
+	}
+	// the environment of the server is not written to the cache
+	files, _ := filepath.Glob(filepath.Join(CacheDir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected one cached file, got %v", files)
+	}
+	if data, _ := os.ReadFile(files[0]); strings.Contains(string(data), "secret-token") {
+		t.Fatalf("expected no secret in the cache, got %s", data)
+	}
+
+	// the tools are cached, the server is started when a tool is called
+	m, err = New(ctx, servers, "stdio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	if names := m.ToolNames(); len(names) != 1 || names[0] != "echo" {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if starts() != 1 {
+		t.Fatalf("expected the server not started, got %d starts", starts())
+	}
+	if got := callText(t, m, "echo"); got != "echo" {
+		t.Fatalf("unexpected result %q", got)
+	}
+	if got := callText(t, m, "echo"); got != "echo" {
+		t.Fatalf("unexpected result %q", got)
+	}
+	if starts() != 2 {
+		t.Fatalf("expected the server started once by the calls, got %d starts", starts()-1)
+	}
+	if m.Refresh(ctx) {
+		t.Fatal("expected the same tools listed")
+	}
+
+	// a required server is started even its tools are cached
+	stdio.Required = true
+	required, err := New(ctx, map[string]ServerConfig{"stdio": stdio}, "stdio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer required.Shutdown()
+	if starts() != 3 {
+		t.Fatalf("expected the required server started, got %d starts", starts()-2)
+	}
+}
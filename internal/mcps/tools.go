@@ -0,0 +1,238 @@
+package mcps
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// toolSeparator joins the server name and the tool name of a qualified tool name.
+const toolSeparator = "__"
+
+// maxToolName is the max length of a tool name accepted by the models.
+const maxToolName = 64
+
+// invalidName matches the characters not allowed in a tool name of the models.
+var invalidName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolInfo is a tool offered to the model, Name is the name offered and Server is the name of its server.
+type ToolInfo struct {
+	Name   string   `json:"name"`
+	Server string   `json:"server"`
+	Tool   mcp.Tool `json:"tool"`
+}
+
+// serverTool is a tool of a server, name is the name known by the server.
+type serverTool struct {
+	client *McpClient
+	name   string
+}
+
+// serverName returns a short name of a provider: a configured name as is, the file name without extensions, or the host of a url.
+func serverName(provider string) string {
+	name := provider
+	if u, err := url.Parse(provider); err == nil && u.Host != "" {
+		name = u.Hostname()
+	} else if strings.ContainsAny(provider, `/\.`) {
+		file, _, _ := strings.Cut(provider, " ")
+		name, _, _ = strings.Cut(filepath.Base(file), ".")
+	}
+	name = invalidName.ReplaceAllString(name, "_")
+	if name == "" {
+		name = "server"
+	}
+	return name
+}
+
+// uniqueServerName returns the name of a new server, a suffix is added when another server has the same name.
+func (m *MCPs) uniqueServerName(base string) string {
+	name := base
+	for i := 2; ; i++ {
+		taken := false
+		for _, client := range m.clients {
+			if client.name == name {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return name
+		}
+		name = base + "_" + strconv.Itoa(i)
+	}
+}
+
+// SetToolFilter sets the glob patterns of the tools offered to the model.
+// A tool is offered when it matches any of allow, or allow is empty, and it matches none of deny.
+// A pattern matches either the tool name, or the qualified name server__tool.
+func (m *MCPs) SetToolFilter(allow, deny []string) error {
+	for _, pattern := range append(append([]string{}, allow...), deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allow = allow
+	m.deny = deny
+	m.registerTools()
+	return nil
+}
+
+// allowed reports whether a tool passes the filter, the names are the tool name and its qualified name.
+func (m *MCPs) allowed(names ...string) bool {
+	matchAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			for _, name := range names {
+				if ok, _ := path.Match(pattern, name); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(m.allow) > 0 && !matchAny(m.allow) {
+		return false
+	}
+	return !matchAny(m.deny)
+}
+
+// QualifiedToolName returns the name server__tool of a tool offered to the model, it's empty for an unknown tool.
+func (m *MCPs) QualifiedToolName(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tool, ok := m.toolToClient[name]
+	if !ok {
+		return ""
+	}
+	return toolName(tool.client.name + toolSeparator + tool.name)
+}
+
+// ToolInfos returns the tools offered to the model with their servers, in the order of Tools.
+func (m *MCPs) ToolInfos() []ToolInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infos := make([]ToolInfo, 0, len(m.Tools))
+	for _, param := range m.Tools {
+		if param.OfFunction == nil {
+			continue
+		}
+		name := param.OfFunction.Function.Name
+		tool := m.toolToClient[name]
+		for _, t := range tool.client.tools {
+			if t.Name == tool.name {
+				infos = append(infos, ToolInfo{Name: name, Server: tool.client.name, Tool: t})
+				break
+			}
+		}
+	}
+	return infos
+}
+
+// OpenAITools returns the tools offered to the model, it's the same slice until the tools are rebuilt.
+func (m *MCPs) OpenAITools() []openai.ChatCompletionToolUnionParam {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.Tools
+}
+
+// Refresh lists the tools again of the servers which notified their tools changed, and rebuilds the tools offered
+// to the model. It reports whether the tools are rebuilt, a server which fails to list its tools keeps the old ones.
+// The tools are listed without holding mu, so a slow server does not block the calls of the other tools.
+func (m *MCPs) Refresh(ctx context.Context) bool {
+	listed := make(map[*McpClient][]mcp.Tool)
+	for _, client := range m.clients {
+		if !client.toolsChanged.Swap(false) {
+			continue
+		}
+		resp, err := client.client.ListTools(ctx, mcp.ListToolsRequest{})
+		if err != nil {
+			slog.Warn("failed to list tools", "provider", client.provider, "error", err)
+			continue
+		}
+		listed[client] = resp.Tools
+	}
+	if len(listed) == 0 {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for client, tools := range listed {
+		client.tools = tools
+	}
+	m.registerTools()
+	slog.Debug("mcp tools refreshed", "tools", len(m.Tools))
+	return true
+}
+
+// registerTools builds the tools offered to the model from the tools of all servers, the caller holds mu.
+// A tool whose name is used by another server is named as server__tool, so the second one does not hide the first.
+// A tool whose name is still taken, e.g. the names differ in the replaced characters only, is skipped with a warning.
+func (m *MCPs) registerTools() {
+	count := make(map[string]int)
+	for _, client := range m.clients {
+		for _, tool := range client.tools {
+			count[toolName(tool.Name)]++
+		}
+	}
+
+	m.toolToClient = make(map[string]serverTool)
+	m.Tools = make([]openai.ChatCompletionToolUnionParam, 0)
+	for _, client := range m.clients {
+		for _, tool := range client.tools {
+			name := toolName(tool.Name)
+			qualified := toolName(client.name + toolSeparator + tool.Name)
+			if !m.allowed(name, qualified) {
+				continue
+			}
+			if count[name] > 1 {
+				name = qualified
+			}
+			if other, ok := m.toolToClient[name]; ok {
+				slog.Warn("mcp tool is skipped, its name is taken", "tool", tool.Name, "server", client.name, "name", name, "by", other.client.name+toolSeparator+other.name)
+				continue
+			}
+			m.toolToClient[name] = serverTool{client: client, name: tool.Name}
+			m.Tools = append(m.Tools, openAITool(name, tool))
+		}
+	}
+}
+
+// toolName replaces the characters not accepted by the models, and limits the length.
+// A long name is cut and ends with a short hash of the whole name, so the names which differ after the cut stay different.
+func toolName(name string) string {
+	valid := invalidName.ReplaceAllString(name, "_")
+	if len(valid) <= maxToolName {
+		return valid
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	return valid[:maxToolName-len(suffix)] + suffix
+}
+
+// openAITool converts a MCP tool to an OpenAI function tool of the name.
+func openAITool(name string, tool mcp.Tool) openai.ChatCompletionToolUnionParam {
+	params := map[string]any{
+		"type":       tool.InputSchema.Type,
+		"properties": tool.InputSchema.Properties,
+		"required":   tool.InputSchema.Required,
+	}
+	return openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+		Name:        name,
+		Description: openai.String(tool.Description),
+		Parameters:  shared.FunctionParameters(params),
+	})
+}
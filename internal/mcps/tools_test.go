@@ -0,0 +1,263 @@
+package mcps
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newInProcessClient creates a client of a server whose tools answer their own name and the server name.
+func newInProcessClient(t *testing.T, name string, tools ...string) *McpClient {
+	t.Helper()
+	s := server.NewMCPServer(name, "1.0.0", server.WithToolCapabilities(false))
+	for _, tool := range tools {
+		answer := name + ":" + tool
+		s.AddTool(mcp.NewTool(tool), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(answer), nil
+		})
+	}
+	return newServerTestClient(t, name, s)
+}
+
+// newServerTestClient creates an initialized client of an in-process server, its tools are listed.
+func newServerTestClient(t *testing.T, name string, s *server.MCPServer) *McpClient {
+	t.Helper()
+	c, err := client.NewInProcessClient(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &McpClient{client: c, provider: name, name: name, tools: list.Tools}
+}
+
+func callText(t *testing.T, m *MCPs, name string) string {
+	t.Helper()
+	msg, _, err := m.CallTool(context.Background(), "call", name, map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.OfTool.Content.OfString.Value
+}
+
+func TestToolNamespacing(t *testing.T) {
+	m := &MCPs{clients: []*McpClient{
+		newInProcessClient(t, "github", "search", "create.issue"),
+		newInProcessClient(t, "docs", "search", "read"),
+	}}
+	m.registerTools()
+
+	names := m.ToolNames()
+	slices.Sort(names)
+	want := []string{"create_issue", "docs__search", "github__search", "read"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if got := callText(t, m, "docs__search"); got != "docs:search" {
+		t.Fatalf("unexpected result %q", got)
+	}
+	if got := callText(t, m, "create_issue"); got != "github:create.issue" {
+		t.Fatalf("unexpected result %q", got)
+	}
+	if _, _, err := m.CallTool(context.Background(), "call", "search", nil); err == nil {
+		t.Fatal("expected the ambiguous name not found")
+	}
+}
+
+func TestToolFilter(t *testing.T) {
+	m := &MCPs{clients: []*McpClient{
+		newInProcessClient(t, "github", "search", "delete_repo"),
+		newInProcessClient(t, "docs", "read"),
+	}}
+	if err := m.SetToolFilter([]string{"github__*"}, []string{"delete_*"}); err != nil {
+		t.Fatal(err)
+	}
+	if names := m.ToolNames(); len(names) != 1 || names[0] != "search" {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if _, _, err := m.CallTool(context.Background(), "call", "delete_repo", nil); err == nil {
+		t.Fatal("expected the denied tool not callable")
+	}
+	if err := m.SetToolFilter([]string{"["}, nil); err == nil {
+		t.Fatal("expected an invalid pattern error")
+	}
+}
+
+func TestServerName(t *testing.T) {
+	cases := map[string]string{
+		"samples/qqwry.mcp.yaml":      "qqwry",
+		"/srv/my server.py --port 1":  "my",
+		"http://127.0.0.1:8000/sse":   "127_0_0_1",
+		"https://mcp.example.com/mcp": "mcp_example_com",
+		"npx":                         "npx",
+	}
+	for provider, want := range cases {
+		if got := serverName(provider); got != want {
+			t.Errorf("serverName(%q) = %q, want %q", provider, got, want)
+		}
+	}
+}
+
+func TestRefreshOnToolsChanged(t *testing.T) {
+	s := server.NewMCPServer("login", "1.0.0", server.WithToolCapabilities(true))
+	s.AddTool(mcp.NewTool("login"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("logged in"), nil
+	})
+	srv := server.NewTestServer(s)
+	defer srv.Close()
+
+	ctx := context.Background()
+	m, err := New(ctx, nil, srv.URL+"/sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	if m.Refresh(ctx) {
+		t.Fatal("expected no refresh before the tools change")
+	}
+
+	s.AddTool(mcp.NewTool("search"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("found"), nil
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.Refresh(ctx) {
+		if time.Now().After(deadline) {
+			t.Fatal("the tools change is not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	names := m.ToolNames()
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"login", "search"}) {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if len(m.OpenAITools()) != 2 {
+		t.Fatalf("unexpected openai tools %d", len(m.OpenAITools()))
+	}
+	if got := callText(t, m, "search"); got != "found" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestToolInfosAndPrompts(t *testing.T) {
+	s := server.NewMCPServer("geo", "1.0.0", server.WithToolCapabilities(false), server.WithPromptCapabilities(false))
+	s.AddTool(mcp.NewTool("locate", mcp.WithDescription("locate an ip"), mcp.WithString("ip", mcp.Required())),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultError("no such ip " + req.GetString("ip", "")), nil
+		})
+	s.AddPrompt(mcp.NewPrompt("summary", mcp.WithArgument("topic", mcp.RequiredArgument())),
+		func(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("summary", nil), nil
+		})
+	m := &MCPs{clients: []*McpClient{newServerTestClient(t, "geo", s), newInProcessClient(t, "docs", "locate")}}
+	m.registerTools()
+
+	infos := m.ToolInfos()
+	if len(infos) != 2 {
+		t.Fatalf("unexpected tools %+v", infos)
+	}
+	if infos[0].Name != "geo__locate" || infos[0].Server != "geo" || infos[0].Tool.Description != "locate an ip" || infos[0].Tool.InputSchema.Required[0] != "ip" {
+		t.Fatalf("unexpected tool %+v", infos[0])
+	}
+
+	result, err := m.CallToolResult(context.Background(), "geo__locate", map[string]any{"ip": "1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || result.Content[0].(mcp.TextContent).Text != "no such ip 1.1.1.1" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	prompts, err := m.Prompts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 1 || prompts[0].Server != "geo" || prompts[0].Prompt.Name != "summary" || !prompts[0].Prompt.Arguments[0].Required {
+		t.Fatalf("unexpected prompts %+v", prompts)
+	}
+}
+
+func TestToolNameCollisions(t *testing.T) {
+	prefix := strings.Repeat("x", maxToolName)
+	m := &MCPs{clients: []*McpClient{newInProcessClient(t, "long", prefix+"_read", prefix+"_write", "a.b", "a_b")}}
+	m.registerTools()
+
+	// the tools are listed by name, a_b clashes with a.b
+	names := m.ToolNames()
+	if len(names) != 3 || names[0] != "long__a_b" {
+		t.Fatalf("expected the long tools kept and a clashing one skipped, got %v", names)
+	}
+	read, write := names[1], names[2]
+	if len(read) != maxToolName || len(write) != maxToolName || read == write {
+		t.Fatalf("unexpected names of the long tools %q and %q", read, write)
+	}
+	if got := callText(t, m, write); got != "long:"+prefix+"_write" {
+		t.Fatalf("unexpected result %q", got)
+	}
+	if got := callText(t, m, "long__a_b"); got != "long:a.b" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestRefreshDoesNotBlockTools(t *testing.T) {
+	// the server hangs on listing its tools until it's released
+	var hang atomic.Bool
+	listing, release := make(chan struct{}), make(chan struct{})
+	hooks := &server.Hooks{}
+	hooks.AddBeforeListTools(func(ctx context.Context, id any, req *mcp.ListToolsRequest) {
+		if hang.Load() {
+			close(listing)
+			<-release
+		}
+	})
+	s := server.NewMCPServer("slow", "1.0.0", server.WithToolCapabilities(true), server.WithHooks(hooks))
+	s.AddTool(mcp.NewTool("echo"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("echo"), nil
+	})
+	m := &MCPs{clients: []*McpClient{newServerTestClient(t, "slow", s)}}
+	m.registerTools()
+
+	hang.Store(true)
+	m.clients[0].toolsChanged.Store(true)
+	refreshed := make(chan bool)
+	go func() { refreshed <- m.Refresh(context.Background()) }()
+	<-listing
+
+	called := make(chan string)
+	go func() {
+		msg, _, err := m.CallTool(context.Background(), "call", "echo", map[string]any{})
+		if err != nil {
+			called <- err.Error()
+			return
+		}
+		called <- msg.OfTool.Content.OfString.Value
+	}()
+	select {
+	case got := <-called:
+		if got != "echo" {
+			t.Fatalf("unexpected result %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tool call is blocked by the refresh")
+	}
+	close(release)
+	if !<-refreshed {
+		t.Fatal("expected the tools refreshed")
+	}
+}
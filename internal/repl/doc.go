@@ -0,0 +1,2 @@
+// Package repl implements the interactive chat mode on the terminal.
+package repl
@@ -0,0 +1,322 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/elsejj/gpt/internal/llm"
+	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/session"
+	"github.com/elsejj/gpt/internal/utils"
+)
+
+const helpText = `commands:
+  /model [name]        show or switch the model, name can be an alias in 'llms'
+  /system [prompt]     show or set the system prompt
+  /mcp [list]          list the tools of the running mcp servers
+  /mcp add <provider>  start a mcp server, it can be a name of 'mcpServers', it keeps running until exit
+  /mcp resources       list the resources of the mcp servers, use them by @mcp:<uri>
+  /image <path>...     attach images to the next question
+  /save <name>         save the conversation as a session
+  /reset               forget the conversation
+  /usage               show the token usage and cost of this chat
+  /help                show this help
+  /exit                quit, Ctrl-D also works
+a line ends with '\' continues on the next line, Ctrl-C stops the current answer.
+`
+
+// REPL is an interactive chat, it keeps the conversation in memory between questions.
+type REPL struct {
+	conf    *utils.AppConf
+	session *session.Session
+	in      *bufio.Reader
+	out     io.Writer
+	images  []string
+	// reading is the read of the input in progress, a read left by a done ctx is taken by the next question.
+	reading chan input
+
+	// cancel stops the answer in progress, it's nil while waiting for input.
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// input is a question read from the input.
+type input struct {
+	line string
+	err  error
+}
+
+// syncWriter serializes the writes of the loop, the input reader and the interrupt handler.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// New creates a REPL that reads questions from in and writes answers to out.
+// When sess is not nil, the conversation is saved to it after each answer.
+func New(conf *utils.AppConf, sess *session.Session, in io.Reader, out io.Writer) *REPL {
+	return &REPL{
+		conf:    conf,
+		session: sess,
+		in:      bufio.NewReader(in),
+		out:     &syncWriter{w: out},
+	}
+}
+
+// Run starts the read-eval loop, first is asked before reading from the input if not empty.
+// The first question is sent as is, the following ones are processed by utils.UserPrompt.
+// Ctrl-C stops the current answer instead of quitting, Run returns when the input ends or ctx is done.
+func (r *REPL) Run(ctx context.Context, first string) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	done := make(chan struct{})
+	defer close(done)
+	go r.handleInterrupts(interrupts, done)
+
+	fmt.Fprintf(r.out, "chat with %s, type /help for commands\n", r.conf.LLM.Model)
+	if strings.TrimSpace(first) != "" {
+		r.ask(ctx, first)
+	}
+	for {
+		line, err := r.next(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(r.out)
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "/") {
+			quit, err := r.command(ctx, line)
+			if err != nil {
+				fmt.Fprintln(r.out, "error:", err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+		r.ask(ctx, utils.UserPrompt(nil, line))
+	}
+}
+
+// handleInterrupts stops the answer in progress on Ctrl-C, or tells how to quit when there is none.
+func (r *REPL) handleInterrupts(interrupts <-chan os.Signal, done <-chan struct{}) {
+	for {
+		select {
+		case <-interrupts:
+			r.mu.Lock()
+			cancel := r.cancel
+			r.mu.Unlock()
+			if cancel != nil {
+				cancel()
+			} else {
+				fmt.Fprint(r.out, "\ntype /exit or press Ctrl-D to quit\n> ")
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// next reads the next question, it gives up when ctx is done.
+// A blocked read can not be stopped, so it's kept for the next call instead of starting another one.
+func (r *REPL) next(ctx context.Context) (string, error) {
+	if r.reading == nil {
+		ch := make(chan input, 1)
+		go func() {
+			line, err := r.readInput()
+			ch <- input{line, err}
+		}()
+		r.reading = ch
+	}
+	select {
+	case res := <-r.reading:
+		r.reading = nil
+		return res.line, res.err
+	case <-ctx.Done():
+		fmt.Fprintln(r.out)
+		return "", ctx.Err()
+	}
+}
+
+// readInput reads one question, lines end with '\' are joined with the next line.
+func (r *REPL) readInput() (string, error) {
+	var lines []string
+	prompt := "> "
+	for {
+		fmt.Fprint(r.out, prompt)
+		line, err := r.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasSuffix(line, "\\") {
+			lines = append(lines, strings.TrimSuffix(line, "\\"))
+			prompt = ". "
+			continue
+		}
+		lines = append(lines, line)
+		return strings.Join(lines, "\n"), nil
+	}
+}
+
+// ask sends the question with the conversation so far, the answer is streamed to the output.
+// An interrupted question is not kept in the conversation.
+func (r *REPL) ask(ctx context.Context, question string) {
+	r.conf.Prompt.User = question
+	r.conf.Prompt.Images = r.images
+	r.images = nil
+
+	ctx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.cancel = nil
+		r.mu.Unlock()
+		cancel()
+	}()
+
+	err := llm.Chat(ctx, r.conf, r.out)
+	fmt.Fprintln(r.out)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			fmt.Fprintln(r.out, "interrupted")
+		} else {
+			fmt.Fprintln(r.out, "error:", err)
+		}
+		return
+	}
+	if r.session != nil {
+		if err := r.save(); err != nil {
+			fmt.Fprintln(r.out, "error:", err)
+		}
+	}
+}
+
+func (r *REPL) save() error {
+	r.session.Messages = r.conf.Prompt.History
+	r.session.Model = r.conf.LLM.Model
+	return r.session.Save()
+}
+
+// command executes a slash command, it returns true when the user wants to quit.
+func (r *REPL) command(ctx context.Context, line string) (bool, error) {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/exit", "/quit":
+		return true, nil
+	case "/help":
+		fmt.Fprint(r.out, helpText)
+	case "/model":
+		if arg != "" {
+			r.conf.Prompt.OverrideModel = arg
+			r.conf.PickupModel()
+		}
+		fmt.Fprintf(r.out, "model: %s, provider: %s\n", r.conf.LLM.Model, r.conf.LLM.Provider)
+	case "/system":
+		if arg != "" {
+			r.conf.Prompt.System = strings.TrimSpace(utils.UserPrompt(nil, arg))
+		}
+		fmt.Fprintf(r.out, "system: %s\n", r.conf.Prompt.System)
+	case "/mcp":
+		return false, r.mcpCommand(ctx, arg)
+	case "/image":
+		if arg == "" {
+			return false, errors.New("usage: /image <path>...")
+		}
+		r.images = append(r.images, strings.Fields(arg)...)
+		fmt.Fprintf(r.out, "%d image(s) will be sent with the next question\n", len(r.images))
+	case "/save":
+		if arg == "" {
+			if r.session == nil {
+				return false, errors.New("usage: /save <name>")
+			}
+			return false, r.save()
+		}
+		sess, err := session.Open(arg)
+		if err != nil {
+			return false, err
+		}
+		r.session = sess
+		if err := r.save(); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(r.out, "saved to session %s\n", arg)
+	case "/reset":
+		r.conf.Prompt.History = nil
+		r.images = nil
+		fmt.Fprintln(r.out, "conversation cleared")
+	case "/usage":
+		usage := r.conf.Prompt.Usage
+		fmt.Fprintf(r.out, "prompt: %d, completion: %d, total: %d, cost: $%.4f, tool failures: %d\n", usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, r.conf.Prompt.Cost, r.conf.Prompt.ToolFailures)
+	default:
+		return false, fmt.Errorf("unknown command %s, type /help for commands", name)
+	}
+	return false, nil
+}
+
+func (r *REPL) mcpCommand(ctx context.Context, arg string) error {
+	sub, provider, _ := strings.Cut(arg, " ")
+	switch sub {
+	case "", "list":
+		if r.conf.Prompt.MCPServers == nil {
+			fmt.Fprintln(r.out, "no mcp server")
+			return nil
+		}
+		for _, name := range r.conf.Prompt.MCPServers.ToolNames() {
+			fmt.Fprintln(r.out, name)
+		}
+	case "resources":
+		if r.conf.Prompt.MCPServers == nil {
+			fmt.Fprintln(r.out, "no mcp server")
+			return nil
+		}
+		resources, templates := r.conf.Prompt.MCPServers.Resources()
+		for _, resource := range resources {
+			fmt.Fprintf(r.out, "%s\t%s\n", resource.URI, resource.Name)
+		}
+		for _, template := range templates {
+			fmt.Fprintf(r.out, "%s\t%s\n", template.URITemplate.Raw(), template.Name)
+		}
+	case "add":
+		provider = strings.TrimSpace(provider)
+		if provider == "" {
+			return errors.New("usage: /mcp add <provider>")
+		}
+		if r.conf.Prompt.MCPServers == nil {
+			servers, err := mcps.New(ctx, r.conf.MCPServers, provider)
+			if err != nil {
+				return err
+			}
+			r.conf.Prompt.MCPServers = servers
+		} else if err := r.conf.Prompt.MCPServers.Add(ctx, provider); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "%d tool(s) available\n", len(r.conf.Prompt.MCPServers.Tools))
+	default:
+		return fmt.Errorf("unknown mcp command %s", sub)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/session"
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+func newTestConf() *utils.AppConf {
+	return &utils.AppConf{
+		LLM: utils.LLM{Model: "gpt-4o-mini", Provider: "openai"},
+		LLMs: map[string]utils.LLM{
+			"ds": {Model: "deepseek-chat", Provider: "deepseek"},
+		},
+		Prompt: &utils.Prompt{},
+	}
+}
+
+func TestCommandsChangeState(t *testing.T) {
+	conf := newTestConf()
+	conf.Prompt.History = []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")}
+
+	input := strings.Join([]string{
+		"/system be brief",
+		"/model ds",
+		"/image a.png b.png",
+		"/reset",
+		"/unknown",
+		"/exit",
+		"never asked",
+	}, "\n")
+	var out bytes.Buffer
+	if err := New(conf, nil, strings.NewReader(input), &out).Run(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Prompt.System != "be brief" {
+		t.Fatalf("unexpected system prompt %q", conf.Prompt.System)
+	}
+	if conf.LLM.Model != "deepseek-chat" || conf.LLM.Provider != "deepseek" {
+		t.Fatalf("model is not switched: %+v", conf.LLM)
+	}
+	if conf.Prompt.History != nil {
+		t.Fatalf("history is not reset")
+	}
+	if !strings.Contains(out.String(), "unknown command /unknown") {
+		t.Fatalf("expected unknown command error, got %s", out.String())
+	}
+}
+
+func TestImagesAttachAndSave(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	conf := newTestConf()
+	conf.Prompt.History = []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi"), openai.AssistantMessage("hello")}
+	r := New(conf, nil, strings.NewReader(""), &bytes.Buffer{})
+
+	if _, err := r.command(context.Background(), "/image a.png b.png"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.images) != 2 {
+		t.Fatalf("expected 2 images, got %v", r.images)
+	}
+	if _, err := r.command(context.Background(), "/save chat1"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := session.Load("chat1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Messages) != 2 {
+		t.Fatalf("expected 2 saved messages, got %d", len(s.Messages))
+	}
+}
+
+func TestReadInputJoinsContinuedLines(t *testing.T) {
+	r := New(newTestConf(), nil, strings.NewReader("first \\\nsecond\n"), &bytes.Buffer{})
+	line, err := r.readInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "first \nsecond" {
+		t.Fatalf("unexpected input %q", line)
+	}
+}
+
+func TestInterruptedQuestionIsDropped(t *testing.T) {
+	conf := newTestConf()
+	var out bytes.Buffer
+	r := New(conf, nil, strings.NewReader(""), &out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.ask(ctx, "hi")
+
+	if !strings.Contains(out.String(), "interrupted") {
+		t.Fatalf("expected interrupted, got %s", out.String())
+	}
+	if len(conf.Prompt.History) != 0 {
+		t.Fatalf("interrupted question is kept: %v", conf.Prompt.History)
+	}
+}
+
+func TestRunStopsWhenContextDone(t *testing.T) {
+	in, _ := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := New(newTestConf(), nil, in, &bytes.Buffer{}).Run(ctx, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestPendingReadIsKept(t *testing.T) {
+	in, w := io.Pipe()
+	r := New(newTestConf(), nil, in, &bytes.Buffer{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.next(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	// the read left by the canceled question answers the next one
+	go w.Write([]byte("hello\n"))
+	if line, err := r.next(context.Background()); line != "hello" || err != nil {
+		t.Fatalf("unexpected question %q %v", line, err)
+	}
+}
@@ -0,0 +1,2 @@
+// Package schema loads JSON schemas for structured output and validates the output against them.
+package schema
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// defaultName is the schema name when it can't be derived from the file name or title.
+const defaultName = "output"
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Schema is a JSON schema, which the model output must match.
+type Schema struct {
+	// Name is sent to the model with the schema.
+	Name string
+	// Definition is the schema document.
+	Definition map[string]any
+	compiled   *jsonschema.Schema
+}
+
+// Load loads a schema from source, which is either an inline JSON document or a file path.
+// A relative path is also looked up in dirs.
+func Load(source string, dirs ...string) (*Schema, error) {
+	source = strings.TrimSpace(source)
+	if strings.HasPrefix(source, "{") {
+		return Parse([]byte(source), defaultName)
+	}
+
+	candidates := []string{source}
+	if !filepath.IsAbs(source) {
+		for _, dir := range dirs {
+			candidates = append(candidates, filepath.Join(dir, source))
+		}
+	}
+	for _, path := range candidates {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		name = strings.TrimSuffix(name, ".schema")
+		return Parse(body, name)
+	}
+	return nil, fmt.Errorf("schema file %s not found", source)
+}
+
+// Parse compiles a schema document, the name is used when the schema has no title.
+func Parse(body []byte, name string) (*Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	definition, ok := doc.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid schema: it must be a JSON object")
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", doc); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if title, ok := definition["title"].(string); ok && title != "" {
+		name = title
+	}
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		name = defaultName
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return &Schema{Name: name, Definition: definition, compiled: compiled}, nil
+}
+
+// Validate checks that output is a JSON document matches the schema.
+func (s *Schema) Validate(output []byte) error {
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(output))
+	if err != nil {
+		return fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	return s.compiled.Validate(instance)
+}
+
+// String returns the schema document as JSON.
+func (s *Schema) String() string {
+	body, _ := json.Marshal(s.Definition)
+	return string(body)
+}
@@ -0,0 +1,59 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const personSchema = `{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string"},
+    "age": {"type": "integer"}
+  },
+  "required": ["name", "age"],
+  "additionalProperties": false
+}`
+
+func TestLoadFromFileAndValidate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "person.schema.json"), []byte(personSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load("person.schema.json", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "person" {
+		t.Fatalf("expected name person, got %q", s.Name)
+	}
+	if err := s.Validate([]byte(`{"name":"alice","age":3}`)); err != nil {
+		t.Fatalf("expected valid output, got %v", err)
+	}
+	err = s.Validate([]byte(`{"name":"alice","age":"3"}`))
+	if err == nil || !strings.Contains(err.Error(), "age") {
+		t.Fatalf("expected error about age, got %v", err)
+	}
+	if err := s.Validate([]byte(`not json`)); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
+
+func TestLoadInline(t *testing.T) {
+	s, err := Load(`{"title":"my result!","type":"array","items":{"type":"string"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "my_result" {
+		t.Fatalf("expected name from title, got %q", s.Name)
+	}
+	if _, err := Load("missing.json", t.TempDir()); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if _, err := Load(`{"type": 1}`); err == nil {
+		t.Fatal("expected error for invalid schema")
+	}
+}
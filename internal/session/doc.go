@@ -0,0 +1,2 @@
+// Package session persists multi-turn conversations between runs.
+package session
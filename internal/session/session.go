@@ -0,0 +1,226 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/openai/openai-go/v3"
+)
+
+const fileExt = ".json"
+
+// Session is a named conversation, it holds the full message history,
+// including assistant tool calls and tool results.
+type Session struct {
+	Name      string                                   `json:"name"`
+	Model     string                                   `json:"model,omitempty"`
+	CreatedAt time.Time                                `json:"createdAt"`
+	UpdatedAt time.Time                                `json:"updatedAt"`
+	Messages  []openai.ChatCompletionMessageParamUnion `json:"messages"`
+}
+
+// Dir returns the directory where sessions are stored.
+func Dir() string {
+	return utils.ConfigPath("sessions")
+}
+
+// Path returns the file path of the session with the given name.
+func Path(name string) string {
+	return filepath.Join(Dir(), name+fileExt)
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("session name is empty")
+	}
+	if strings.ContainsAny(name, `/\:`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid session name %q", name)
+	}
+	return nil
+}
+
+// Open loads the session with the given name, or creates a new empty one if it does not exist.
+func Open(name string) (*Session, error) {
+	s, err := Load(name)
+	if errors.Is(err, os.ErrNotExist) {
+		now := time.Now()
+		return &Session{Name: name, CreatedAt: now, UpdatedAt: now}, nil
+	}
+	return s, err
+}
+
+// Load reads the session with the given name from disk.
+func Load(name string) (*Session, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(Path(name))
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, fmt.Errorf("parse session %s: %w", name, err)
+	}
+	s.Name = name
+	return &s, nil
+}
+
+// Save writes the session to disk, it updates the UpdatedAt field.
+func (s *Session) Save() error {
+	if err := validateName(s.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(Dir(), 0o755); err != nil {
+		return fmt.Errorf("create session directory: %w", err)
+	}
+	s.UpdatedAt = time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = s.UpdatedAt
+	}
+	body, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temp file first, so a crash will not corrupt the history
+	tmp := Path(s.Name) + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o600); err != nil {
+		return fmt.Errorf("write session %s: %w", s.Name, err)
+	}
+	return os.Rename(tmp, Path(s.Name))
+}
+
+// List returns all saved sessions, the most recently updated first.
+func List() ([]*Session, error) {
+	entries, err := os.ReadDir(Dir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != fileExt {
+			continue
+		}
+		s, err := Load(strings.TrimSuffix(entry.Name(), fileExt))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// Last returns the most recently updated session.
+func Last() (*Session, error) {
+	sessions, err := List()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("no session to continue")
+	}
+	return sessions[0], nil
+}
+
+// Fork copies the session src to a new session dst.
+func Fork(src, dst string) (*Session, error) {
+	if err := validateName(dst); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(Path(dst)); err == nil {
+		return nil, fmt.Errorf("session %s already exists", dst)
+	}
+	s, err := Load(src)
+	if err != nil {
+		return nil, err
+	}
+	s.Name = dst
+	s.CreatedAt = time.Now()
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Delete removes the session with the given name.
+func Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	return os.Remove(Path(name))
+}
+
+// WriteTranscript writes a human readable form of the messages to w.
+func (s *Session) WriteTranscript(w io.Writer) error {
+	for _, message := range s.Messages {
+		body, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		var m struct {
+			Role       string `json:"role"`
+			Content    any    `json:"content"`
+			ToolCallID string `json:"tool_call_id"`
+			ToolCalls  []struct {
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		}
+		if err := json.Unmarshal(body, &m); err != nil {
+			return err
+		}
+		if text := contentText(m.Content); text != "" {
+			if m.ToolCallID != "" {
+				fmt.Fprintf(w, "[%s %s]\n%s\n\n", m.Role, m.ToolCallID, text)
+			} else {
+				fmt.Fprintf(w, "[%s]\n%s\n\n", m.Role, text)
+			}
+		}
+		for _, call := range m.ToolCalls {
+			fmt.Fprintf(w, "[%s tool call] %s %s\n\n", m.Role, call.Function.Name, call.Function.Arguments)
+		}
+	}
+	return nil
+}
+
+// contentText flattens a message content, which is either a string or a list of parts.
+func contentText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []any:
+		parts := make([]string, 0, len(c))
+		for _, item := range c {
+			part, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "text":
+				text, _ := part["text"].(string)
+				parts = append(parts, text)
+			case "image_url":
+				parts = append(parts, "<image>")
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
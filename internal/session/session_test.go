@@ -0,0 +1,96 @@
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+)
+
+func TestSaveLoadKeepsToolCalls(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	s, err := Open("debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Messages = []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage("be brief"),
+		openai.UserMessage("what is 1+2?"),
+		{OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+			ToolCalls: []openai.ChatCompletionMessageToolCallUnionParam{{
+				OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+					ID: "call_1",
+					Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+						Name:      "add",
+						Arguments: `{"a":1,"b":2}`,
+					},
+				},
+			}},
+		}},
+		openai.ToolMessage("3", "call_1"),
+		openai.AssistantMessage("1+2 is 3"),
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load("debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 5 {
+		t.Fatalf("expected 5 messages, got %d", len(loaded.Messages))
+	}
+	call := loaded.Messages[2].OfAssistant
+	if call == nil || len(call.ToolCalls) != 1 || call.ToolCalls[0].OfFunction.Function.Name != "add" {
+		t.Fatalf("tool call is not restored: %+v", loaded.Messages[2])
+	}
+	if tool := loaded.Messages[3].OfTool; tool == nil || tool.ToolCallID != "call_1" {
+		t.Fatalf("tool result is not restored: %+v", loaded.Messages[3])
+	}
+
+	var buf bytes.Buffer
+	if err := loaded.WriteTranscript(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `add {"a":1,"b":2}`) {
+		t.Fatalf("transcript misses tool call: %s", buf.String())
+	}
+}
+
+func TestForkListDelete(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	s, _ := Open("a")
+	s.Messages = []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Fork("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Fork("a", "b"); err == nil {
+		t.Fatal("expected error when fork to an existing session")
+	}
+
+	sessions, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].Name != "b" {
+		t.Fatalf("expected b to be the most recent session, got %+v", sessions)
+	}
+
+	if err := Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	last, err := Last()
+	if err != nil || last.Name != "b" {
+		t.Fatalf("expected last session b, got %v, %v", last, err)
+	}
+	if _, err := Open("../x"); err == nil {
+		t.Fatal("expected error for invalid name")
+	}
+}
@@ -3,9 +3,7 @@ package tools
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -34,8 +32,8 @@ var actionConfirmMessages = map[toolActionType]string{
 // DoAction executes the configured action for the tool.
 // It supports printing to stdout, copying to clipboard, saving to disk and executing commands.
 // Placeholders in the action string (e.g. ${name}) are replaced by the provided params and result content.
-// When confirmed is false, the user will be asked to confirm before performing non-output actions.
-func (tool *Tool) DoAction(content []byte, params map[string]string, confirmed bool) error {
+// When confirmed is false, the user will be asked to confirm before performing non-output actions, the answer is read from in.
+func (tool *Tool) DoAction(content []byte, params map[string]string, confirmed bool, in *bufio.Reader) error {
 	if tool == nil {
 		return fmt.Errorf("tool is nil")
 	}
@@ -48,7 +46,7 @@ func (tool *Tool) DoAction(content []byte, params map[string]string, confirmed b
 
 	actionType, target := classifyAction(action)
 	if actionType != actionOutput && !confirmed {
-		ok, err := confirmAction(actionType, target, content)
+		ok, err := confirmAction(in, actionType, target, content)
 		if err != nil {
 			return err
 		}
@@ -92,7 +90,8 @@ func classifyAction(action string) (toolActionType, string) {
 	return actionExecute, clean
 }
 
-func confirmAction(actionType toolActionType, action string, content []byte) (bool, error) {
+// confirmAction asks the user to confirm an action, the answer is read from in like the other questions to the user.
+func confirmAction(in *bufio.Reader, actionType toolActionType, action string, content []byte) (bool, error) {
 	message, ok := actionConfirmMessages[actionType]
 	if !ok {
 		return false, fmt.Errorf("no confirm message for action type %d", actionType)
@@ -100,14 +99,10 @@ func confirmAction(actionType toolActionType, action string, content []byte) (bo
 	if actionType == actionExecute && strings.TrimSpace(action) == "" {
 		action = string(content)
 	}
-	fmt.Fprintf(os.Stderr, message, action)
-	reader := bufio.NewReader(os.Stdin)
-	answer, err := reader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
-		return false, err
+	if strings.Contains(message, "%q") {
+		message = fmt.Sprintf(message, action)
 	}
-	answer = strings.TrimSpace(answer)
-	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes"), nil
+	return Ask(in, os.Stderr, message)
 }
 
 func copyToClipboard(content []byte) error {
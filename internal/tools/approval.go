@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Approval asks the user to approve the mcp tool calls of the model before they run.
+type Approval struct {
+	// patterns are the glob patterns of the tools to ask for.
+	patterns []string
+	// always are the tools answered with 'always', they are not asked again.
+	always map[string]bool
+
+	mu  sync.Mutex
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewApproval creates the approval of a policy, which is a list of glob patterns of the tools to ask for.
+// "always" asks for every tool, "never" asks for none and removes the patterns before it.
+// It returns nil when no tool needs approval.
+func NewApproval(policy []string, in io.Reader, out io.Writer) (*Approval, error) {
+	patterns := make([]string, 0, len(policy))
+	for _, pattern := range policy {
+		switch pattern = strings.TrimSpace(pattern); strings.ToLower(pattern) {
+		case "", "never":
+			patterns = patterns[:0]
+			continue
+		case "always":
+			pattern = "*"
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid approval pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	return &Approval{
+		patterns: patterns,
+		always:   make(map[string]bool),
+		in:       bufio.NewReader(in),
+		out:      out,
+	}, nil
+}
+
+// needed reports whether a call of the tool must be approved, a pattern matches any of its names.
+func (a *Approval) needed(names ...string) bool {
+	if a.always[names[0]] {
+		return false
+	}
+	for _, pattern := range a.patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Confirm asks the user whether the tool is called with the arguments, names are the name of the tool and its other names.
+// The answer is y(es), n(o), a(lways) approves the later calls of the tool too, e(dit) approves the call with the arguments
+// typed by the user. It returns the arguments to call the tool with, and whether the call is approved.
+// A call is denied when the input ends.
+func (a *Approval) Confirm(arguments string, names ...string) (string, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.needed(names...) {
+		return arguments, true, nil
+	}
+
+	fmt.Fprintf(a.out, "call tool %q with arguments:\n%s\n", names[0], prettyJSON(arguments))
+	for {
+		fmt.Fprint(a.out, "approve?, [y/N/a(lways)/e(dit)]: ")
+		answer, err := readAnswer(a.in)
+		if err != nil {
+			return arguments, false, ignoreEOF(err)
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return arguments, true, nil
+		case "a", "always":
+			a.always[names[0]] = true
+			return arguments, true, nil
+		case "e", "edit":
+			fmt.Fprint(a.out, "arguments (JSON in one line): ")
+			edited, err := readAnswer(a.in)
+			if err != nil {
+				return arguments, false, ignoreEOF(err)
+			}
+			var args map[string]any
+			if err := json.Unmarshal([]byte(edited), &args); err != nil {
+				fmt.Fprintf(a.out, "invalid arguments: %v\n", err)
+				continue
+			}
+			return edited, true, nil
+		default:
+			return arguments, false, nil
+		}
+	}
+}
+
+// Ask asks the user a question whose answer is y(es) or n(o), the answer is no when the input ends.
+func Ask(in *bufio.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprint(out, question)
+	answer, err := readAnswer(in)
+	if err != nil {
+		return false, ignoreEOF(err)
+	}
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes"), nil
+}
+
+// readAnswer reads an answer, io.EOF is returned only when the input ends without an answer.
+func readAnswer(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// ignoreEOF returns nil for io.EOF, a call is denied without error when the input ends.
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// prettyJSON indents the JSON arguments, they are returned as is when they are not JSON.
+func prettyJSON(arguments string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(arguments), "", "  "); err != nil {
+		return arguments
+	}
+	return buf.String()
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestApprovalPolicy(t *testing.T) {
+	if a, err := NewApproval(nil, nil, io.Discard); a != nil || err != nil {
+		t.Fatalf("expected no approval, got %v %v", a, err)
+	}
+	if a, err := NewApproval([]string{"always", "never"}, nil, io.Discard); a != nil || err != nil {
+		t.Fatalf("expected never to clear the patterns, got %v %v", a, err)
+	}
+	if _, err := NewApproval([]string{"["}, nil, io.Discard); err == nil {
+		t.Fatal("expected an invalid pattern error")
+	}
+
+	// only the tools of the fs server are asked, the input has no answer, so the call is denied
+	a, err := NewApproval([]string{"fs__*"}, strings.NewReader(""), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := a.Confirm(`{}`, "search", "web__search"); !ok || err != nil {
+		t.Fatalf("expected search approved without asking, got %v %v", ok, err)
+	}
+	if _, ok, err := a.Confirm(`{}`, "write_file", "fs__write_file"); ok || err != nil {
+		t.Fatalf("expected write_file denied, got %v %v", ok, err)
+	}
+}
+
+func TestApprovalAnswers(t *testing.T) {
+	var out strings.Builder
+	// an invalid edit is asked again
+	in := strings.NewReader("y\nn\ne\nnot json\ne\n{\"path\":\"b\"}\na\n")
+	a, err := NewApproval([]string{"always"}, in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		want      string
+		approved  bool
+		arguments string
+	}{
+		{"yes", true, `{"path":"a"}`},
+		{"no", false, `{"path":"a"}`},
+		{"edit", true, `{"path":"b"}`},
+		{"always", true, `{"path":"a"}`},
+		// no more input, but it's approved by always
+		{"always again", true, `{"path":"a"}`},
+	}
+	for _, c := range cases {
+		arguments, approved, err := a.Confirm(`{"path":"a"}`, "write_file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if approved != c.approved || arguments != c.arguments {
+			t.Fatalf("%s: got %v %s", c.want, approved, arguments)
+		}
+	}
+	if !strings.Contains(out.String(), "\"path\": \"a\"") || !strings.Contains(out.String(), "invalid arguments") {
+		t.Fatalf("unexpected prompt %q", out.String())
+	}
+}
+
+func TestConfirmActionSharesReader(t *testing.T) {
+	// the answers of two actions are read from the same reader, the first one does not buffer the second
+	in := bufio.NewReader(strings.NewReader("y\nno\n"))
+	if ok, err := confirmAction(in, actionSave, "out.txt", nil); !ok || err != nil {
+		t.Fatalf("expected the save confirmed, got %v %v", ok, err)
+	}
+	if ok, err := confirmAction(in, actionCopy, "", nil); ok || err != nil {
+		t.Fatalf("expected the copy cancelled, got %v %v", ok, err)
+	}
+	if ok, err := confirmAction(in, actionExecute, "", []byte("ls")); ok || err != nil {
+		t.Fatalf("expected the execute cancelled at the end of the input, got %v %v", ok, err)
+	}
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Elicitor asks the user on the terminal for the input requested by the mcp servers, it implements mcps.Elicitor.
+type Elicitor struct {
+	mu  sync.Mutex
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewElicitor creates an elicitor which reads the answers from in and writes the questions to out.
+func NewElicitor(in io.Reader, out io.Writer) *Elicitor {
+	return &Elicitor{in: bufio.NewReader(in), out: out}
+}
+
+// elicitSchema is the requested schema of an elicitation, an object of primitive properties.
+type elicitSchema struct {
+	Properties map[string]elicitProperty `json:"properties"`
+	Required   []string                  `json:"required"`
+}
+
+type elicitProperty struct {
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Enum        []string `json:"enum"`
+	Default     any      `json:"default"`
+	Minimum     *float64 `json:"minimum"`
+	Maximum     *float64 `json:"maximum"`
+	MinLength   *int     `json:"minLength"`
+	MaxLength   *int     `json:"maxLength"`
+}
+
+// Elicit shows the message of the server, and asks the value of each property of the requested schema.
+// The request is declined when the user does not want to answer, and canceled when the input ends.
+func (e *Elicitor) Elicit(ctx context.Context, server string, req mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var schema elicitSchema
+	data, err := json.Marshal(req.Params.RequestedSchema)
+	if err == nil {
+		err = json.Unmarshal(data, &schema)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid requested schema: %w", err)
+	}
+
+	fmt.Fprintf(e.out, "mcp server %q asks: %s\n", server, req.Params.Message)
+	fmt.Fprint(e.out, "answer?, [y/N]: ")
+	answer, err := readAnswer(e.in)
+	if err != nil {
+		return elicitCanceled(err)
+	}
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionDecline}}, nil
+	}
+
+	content := make(map[string]any)
+	for _, name := range schema.names() {
+		value, err := e.ask(name, schema.Properties[name], slices.Contains(schema.Required, name))
+		if err != nil {
+			return elicitCanceled(err)
+		}
+		if value != nil {
+			content[name] = value
+		}
+	}
+	return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{
+		Action:  mcp.ElicitationResponseActionAccept,
+		Content: content,
+	}}, nil
+}
+
+// names returns the names of the properties, the required ones first.
+func (s *elicitSchema) names() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := slices.Contains(s.Required, names[i]), slices.Contains(s.Required, names[j])
+		if ri != rj {
+			return ri
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// ask asks the value of a property until it's valid, nil is returned when an optional property is not answered.
+func (e *Elicitor) ask(name string, property elicitProperty, required bool) (any, error) {
+	question := strings.TrimSpace(property.Title + " (" + name + ")")
+	if property.Description != "" {
+		question += ", " + property.Description
+	}
+	switch {
+	case len(property.Enum) > 0:
+		question += " [" + strings.Join(property.Enum, "/") + "]"
+	case property.Type == "boolean":
+		question += " [y/n]"
+	}
+	if property.Default != nil {
+		question += fmt.Sprintf(" (default %v)", property.Default)
+	} else if !required {
+		question += " (optional)"
+	}
+
+	for {
+		fmt.Fprint(e.out, "  "+question+": ")
+		answer, err := readAnswer(e.in)
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			if property.Default != nil {
+				return property.Default, nil
+			}
+			if !required {
+				return nil, nil
+			}
+			fmt.Fprintln(e.out, "  a value is required")
+			continue
+		}
+		value, err := property.parse(answer)
+		if err != nil {
+			fmt.Fprintf(e.out, "  invalid value: %v\n", err)
+			continue
+		}
+		return value, nil
+	}
+}
+
+// parse converts an answer to the type of the property, and checks its constraints.
+func (p *elicitProperty) parse(answer string) (any, error) {
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, answer) {
+		return nil, fmt.Errorf("it must be one of %s", strings.Join(p.Enum, ", "))
+	}
+	switch p.Type {
+	case "boolean":
+		switch strings.ToLower(answer) {
+		case "y", "yes", "true":
+			return true, nil
+		case "n", "no", "false":
+			return false, nil
+		}
+		return nil, errors.New("it must be y or n")
+	case "integer", "number":
+		number, err := strconv.ParseFloat(answer, 64)
+		if err != nil || (p.Type == "integer" && number != float64(int64(number))) {
+			return nil, fmt.Errorf("it must be %s", map[string]string{"integer": "an integer", "number": "a number"}[p.Type])
+		}
+		if p.Minimum != nil && number < *p.Minimum {
+			return nil, fmt.Errorf("it must be at least %v", *p.Minimum)
+		}
+		if p.Maximum != nil && number > *p.Maximum {
+			return nil, fmt.Errorf("it must be at most %v", *p.Maximum)
+		}
+		if p.Type == "integer" {
+			return int64(number), nil
+		}
+		return number, nil
+	default:
+		length := len([]rune(answer))
+		if p.MinLength != nil && length < *p.MinLength {
+			return nil, fmt.Errorf("it must have at least %d characters", *p.MinLength)
+		}
+		if p.MaxLength != nil && length > *p.MaxLength {
+			return nil, fmt.Errorf("it must have at most %d characters", *p.MaxLength)
+		}
+		return answer, nil
+	}
+}
+
+// elicitCanceled cancels the request when the input ends, other errors are returned.
+func elicitCanceled(err error) (*mcp.ElicitationResult, error) {
+	if err = ignoreEOF(err); err != nil {
+		return nil, err
+	}
+	return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionCancel}}, nil
+}
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func elicitRequest() mcp.ElicitationRequest {
+	req := mcp.ElicitationRequest{}
+	req.Params.Message = "create the repository"
+	req.Params.RequestedSchema = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":       map[string]any{"type": "string", "title": "Name", "minLength": 2},
+			"visibility": map[string]any{"type": "string", "enum": []string{"public", "private"}, "default": "private"},
+			"stars":      map[string]any{"type": "integer", "minimum": 0},
+			"archived":   map[string]any{"type": "boolean"},
+			"topic":      map[string]any{"type": "string"},
+		},
+		"required": []string{"name", "stars", "archived"},
+	}
+	return req
+}
+
+func TestElicitAccept(t *testing.T) {
+	// the required properties are asked first: archived, name, stars, then topic and visibility
+	in := "y\nmaybe\nn\n\na\ngpt\n1.5\n-1\n3\n\ninternal\n\n"
+	var out strings.Builder
+	result, err := NewElicitor(strings.NewReader(in), &out).Elicit(context.Background(), "github", elicitRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"name": "gpt", "stars": int64(3), "archived": false, "visibility": "private"}
+	if result.Action != mcp.ElicitationResponseActionAccept || !reflect.DeepEqual(result.Content, want) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	for _, s := range []string{`mcp server "github" asks: create the repository`, "a value is required", "at least 2 characters", "must be an integer", "at least 0", "must be y or n", "must be one of public, private"} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("%q is not shown in %q", s, out.String())
+		}
+	}
+}
+
+func TestElicitDeclineAndCancel(t *testing.T) {
+	result, err := NewElicitor(strings.NewReader("n\n"), io.Discard).Elicit(context.Background(), "github", elicitRequest())
+	if err != nil || result.Action != mcp.ElicitationResponseActionDecline {
+		t.Fatalf("expected declined, got %+v %v", result, err)
+	}
+	result, err = NewElicitor(strings.NewReader("y\ngpt\n"), io.Discard).Elicit(context.Background(), "github", elicitRequest())
+	if err != nil || result.Action != mcp.ElicitationResponseActionCancel {
+		t.Fatalf("expected canceled, got %+v %v", result, err)
+	}
+}
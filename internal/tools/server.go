@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Runner runs a tool with the user input and the values of its variables, it returns the output of the model.
+type Runner func(ctx context.Context, name string, tool Tool, user string, variables map[string]string) (string, error)
+
+// invalidToolName matches the characters not allowed in a MCP tool name.
+var invalidToolName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// NewMCPServer creates a MCP server which publishes the tools of the names, a call of a tool is run by run.
+func NewMCPServer(version string, names []string, run Runner) (*server.MCPServer, error) {
+	s := server.NewMCPServer("gpt", version, server.WithToolCapabilities(false))
+	for _, name := range names {
+		tool, err := Load(name)
+		if err != nil {
+			return nil, fmt.Errorf("load tool %s: %w", name, err)
+		}
+		s.AddTool(tool.MCPTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			user, variables := toolArguments(req.GetArguments())
+			output, err := run(ctx, name, tool, user, variables)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(output), nil
+		})
+	}
+	return s, nil
+}
+
+// MCPTool describes the tool as a MCP tool, its input is the user argument and its variables.
+func (tool *Tool) MCPTool(name string) mcp.Tool {
+	description := tool.Description
+	if description == "" {
+		// the first line of the system prompt usually tells what the tool does
+		description, _, _ = strings.Cut(strings.TrimSpace(tool.SystemPrompt), "\n")
+	}
+	if description == "" {
+		description = "run the " + name + " tool"
+	}
+
+	opts := []mcp.ToolOption{
+		mcp.WithDescription(description),
+		mcp.WithString("user", mcp.Required(), mcp.Description("the user input")),
+	}
+	for _, variable := range tool.Variables() {
+		opts = append(opts, mcp.WithString(variable, mcp.Required(), mcp.Description("the value of ${"+variable+"} in the prompt")))
+	}
+	return mcp.NewTool(invalidToolName.ReplaceAllString(name, "_"), opts...)
+}
+
+// toolArguments splits the arguments of a call into the user input and the variables.
+func toolArguments(args map[string]any) (string, map[string]string) {
+	user := ""
+	variables := make(map[string]string)
+	for k, v := range args {
+		value, ok := v.(string)
+		if !ok {
+			value = fmt.Sprint(v)
+		}
+		if k == "user" {
+			user = value
+		} else {
+			variables[k] = value
+		}
+	}
+	return user, variables
+}
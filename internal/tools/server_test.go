@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/utils"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func writeTool(t *testing.T, name, body string) {
+	t.Helper()
+	dir := utils.ConfigPath("tools")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVariablesAndList(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeTool(t, "greet.toml", `
+system = "Greet ${name} on ${OS} in ${lang}, today is ${TODAY}"
+user = "${name}: {{user}} ${STDIN}"
+`)
+	writeTool(t, "notes.txt", "not a tool")
+
+	names, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"greet"}) {
+		t.Fatalf("unexpected tools %v", names)
+	}
+
+	tool, err := Load("greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tool.Variables(); !reflect.DeepEqual(got, []string{"name", "lang"}) {
+		t.Fatalf("unexpected variables %v", got)
+	}
+}
+
+func TestMCPServerRunsTool(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeTool(t, "tr.toml", `
+description = "translate the text"
+system = "translate to ${lang}"
+`)
+
+	var gotName, gotUser string
+	var gotVariables map[string]string
+	run := func(ctx context.Context, name string, tool Tool, user string, variables map[string]string) (string, error) {
+		gotName, gotUser, gotVariables = name, user, variables
+		return "bonjour", nil
+	}
+	s, err := NewMCPServer("test", []string{"tr"}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.NewInProcessClient(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tools) != 1 {
+		t.Fatalf("expected one tool, got %d", len(list.Tools))
+	}
+	tool := list.Tools[0]
+	if tool.Name != "tr" || tool.Description != "translate the text" {
+		t.Fatalf("unexpected tool %+v", tool)
+	}
+	if !reflect.DeepEqual(tool.InputSchema.Required, []string{"user", "lang"}) {
+		t.Fatalf("unexpected required arguments %v", tool.InputSchema.Required)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "tr"
+	req.Params.Arguments = map[string]any{"user": "hello", "lang": "French"}
+	result, err := c.CallTool(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok || text.Text != "bonjour" || result.IsError {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if gotName != "tr" || gotUser != "hello" || gotVariables["lang"] != "French" {
+		t.Fatalf("unexpected run %s %q %v", gotName, gotUser, gotVariables)
+	}
+}
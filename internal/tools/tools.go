@@ -3,17 +3,23 @@ package tools
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	filepath "path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/elsejj/gpt/internal/mcps"
 	"github.com/elsejj/gpt/internal/utils"
 	"github.com/goccy/go-yaml"
 )
 
 // Tool represents the configuration for a language model tool, when specified, will override global settings.
+// Schema is a JSON schema file path or an inline JSON schema, which the output must match.
+// Description tells what the tool does when it's published as a MCP tool.
 type Tool struct {
+	Description  string   `yaml:"description,omitempty" json:"description,omitempty" toml:"description,omitempty"`
 	Model        string   `yaml:"model,omitempty" json:"model,omitempty" toml:"model,omitempty"`
 	Key          string   `yaml:"key,omitempty" json:"key,omitempty" toml:"key,omitempty"`
 	URL          string   `yaml:"url,omitempty" json:"url,omitempty" toml:"url,omitempty"`
@@ -23,6 +29,14 @@ type Tool struct {
 	UserTemplate string   `yaml:"user,omitempty" json:"user,omitempty" toml:"user,omitempty"`
 	Action       string   `yaml:"action,omitempty" json:"action,omitempty" toml:"action,omitempty"`
 	MCPs         []string `yaml:"mcps,omitempty" json:"mcps,omitempty" toml:"mcps,omitempty"`
+	Schema       string   `yaml:"schema,omitempty" json:"schema,omitempty" toml:"schema,omitempty"`
+	// AllowTools and DenyTools are the glob patterns of the MCP tools offered to the model, see mcps.MCPs.SetToolFilter.
+	AllowTools []string `yaml:"allowTools,omitempty" json:"allowTools,omitempty" toml:"allowTools,omitempty"`
+	DenyTools  []string `yaml:"denyTools,omitempty" json:"denyTools,omitempty" toml:"denyTools,omitempty"`
+	// ApproveTools are the glob patterns of the MCP tools which are called after the user approves, see NewApproval.
+	ApproveTools []string `yaml:"approveTools,omitempty" json:"approveTools,omitempty" toml:"approveTools,omitempty"`
+	// MCPServers are the MCP servers of the tool, they are started with the tool and override the configured ones of the same name.
+	MCPServers map[string]mcps.ServerConfig `yaml:"mcpServers,omitempty" json:"mcpServers,omitempty" toml:"mcpServers,omitempty"`
 }
 
 var parsers = map[string]func([]byte, *Tool) error{
@@ -61,6 +75,62 @@ func (tool *Tool) UserPrompt(user string) string {
 	return tool.UserTemplate + "\n" + user
 }
 
+// Variables returns the names of the ${name} placeholders in the prompts of the tool.
+// The variables provided by the app, such as OS and TODAY, and the STDIN placeholder are not included.
+func (tool *Tool) Variables() []string {
+	var names []string
+	for _, name := range utils.VariableNames(tool.SystemPrompt + "\n" + tool.UserTemplate) {
+		if name != "STDIN" && !utils.IsGlobalVariable(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Servers merges the MCP servers of the tool into the configured ones, and returns the providers to start.
+// The providers are the mcps of the tool, or the given ones when the tool has none, plus the servers of the tool.
+func (tool *Tool) Servers(configured map[string]mcps.ServerConfig, providers []string) (map[string]mcps.ServerConfig, []string) {
+	servers := maps.Clone(configured)
+	if servers == nil {
+		servers = make(map[string]mcps.ServerConfig)
+	}
+	maps.Copy(servers, tool.MCPServers)
+
+	providers = slices.Clone(utils.Or(tool.MCPs, providers))
+	names := slices.Sorted(maps.Keys(tool.MCPServers))
+	for _, name := range names {
+		if !slices.Contains(providers, name) {
+			providers = append(providers, name)
+		}
+	}
+	return servers, providers
+}
+
+// List returns the names of the tools in the tools folder of the configuration directory.
+func List() ([]string, error) {
+	entries, err := os.ReadDir(utils.ConfigPath("tools"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if _, ok := parsers[ext]; !ok || entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
 func findFile(name string) (string, error) {
 	tryFiles := []string{}
 	ext := strings.ToLower(filepath.Ext(name))
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elsejj/gpt/internal/mcps"
+)
+
+func TestServers(t *testing.T) {
+	configured := map[string]mcps.ServerConfig{
+		"github": {Command: "npx"},
+		"fs":     {Command: "fs-server"},
+	}
+	tool := Tool{
+		MCPs:       []string{"github"},
+		MCPServers: map[string]mcps.ServerConfig{"fs": {Command: "fs-server", Args: []string{"/tmp"}}},
+	}
+
+	servers, providers := tool.Servers(configured, []string{"ignored"})
+	if !reflect.DeepEqual(providers, []string{"github", "fs"}) {
+		t.Fatalf("unexpected providers %v", providers)
+	}
+	if len(servers["fs"].Args) != 1 || servers["github"].Command != "npx" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+	if len(configured["fs"].Args) != 0 {
+		t.Fatal("the configured servers are changed")
+	}
+
+	var empty Tool
+	if _, providers := empty.Servers(nil, []string{"github"}); !reflect.DeepEqual(providers, []string{"github"}) {
+		t.Fatalf("unexpected providers %v", providers)
+	}
+}
@@ -0,0 +1,2 @@
+// Package usage keeps a local ledger of the token usage and cost of the chats, and summarizes it.
+package usage
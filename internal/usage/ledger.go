@@ -0,0 +1,157 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/elsejj/gpt/internal/utils"
+)
+
+// Entry is the usage of a model in one chat.
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider,omitempty"`
+	Model            string    `json:"model"`
+	Tool             string    `json:"tool,omitempty"`
+	PromptTokens     int64     `json:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens"`
+	CachedTokens     int64     `json:"cachedTokens,omitempty"`
+	ReasoningTokens  int64     `json:"reasoningTokens,omitempty"`
+	// Cost is in USD, it's zero when the model has no pricing.
+	Cost float64 `json:"cost"`
+}
+
+// Path returns the path of the ledger file.
+func Path() string {
+	return utils.ConfigPath("usage.jsonl")
+}
+
+// Append appends the entries to the ledger, one JSON object per line.
+func Append(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	path := Path()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the lines are written at once, so concurrent runs do not interleave
+	var body []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		body = append(append(body, line...), '\n')
+	}
+	_, err = f.Write(body)
+	return err
+}
+
+// Read reads the entries recorded since the given time, a broken line is skipped.
+func Read(since time.Time) ([]Entry, error) {
+	f, err := os.Open(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.Warn("skip broken usage entry", "line", n, "err", err)
+			continue
+		}
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Row is the total usage of a group of entries.
+type Row struct {
+	Key              string
+	Chats            int
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+// GroupBy names the key the entries are grouped by.
+type GroupBy string
+
+const (
+	ByDay   GroupBy = "day"
+	ByModel GroupBy = "model"
+	ByTool  GroupBy = "tool"
+)
+
+// key returns the group key of an entry.
+func (by GroupBy) key(entry Entry) (string, error) {
+	switch by {
+	case ByDay:
+		return entry.Time.Local().Format(time.DateOnly), nil
+	case ByModel:
+		if entry.Provider == "" {
+			return entry.Model, nil
+		}
+		return entry.Model + ":" + entry.Provider, nil
+	case ByTool:
+		return utils.Or(entry.Tool, "-"), nil
+	default:
+		return "", fmt.Errorf("unknown group %q, it can be one of day, model, tool", by)
+	}
+}
+
+// Summarize groups the entries and sums their usage. The days are sorted in time order,
+// the models and the tools are sorted by cost, the most expensive first.
+func Summarize(entries []Entry, by GroupBy) ([]Row, error) {
+	if _, err := by.key(Entry{}); err != nil {
+		return nil, err
+	}
+	rows := make(map[string]*Row)
+	for _, entry := range entries {
+		key, _ := by.key(entry)
+		row, ok := rows[key]
+		if !ok {
+			row = &Row{Key: key}
+			rows[key] = row
+		}
+		row.Chats++
+		row.PromptTokens += entry.PromptTokens
+		row.CompletionTokens += entry.CompletionTokens
+		row.Cost += entry.Cost
+	}
+
+	result := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if by != ByDay && result[i].Cost != result[j].Cost {
+			return result[i].Cost > result[j].Cost
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package usage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAppendReadSummarize(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.Add(24 * time.Hour)
+	if err := Append(
+		Entry{Time: day1, Model: "gpt-4o", Provider: "openai", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5},
+		Entry{Time: day1, Model: "qwen", Provider: "ollama", Tool: "tr", PromptTokens: 50, CompletionTokens: 5},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(Entry{Time: day2, Model: "gpt-4o", Provider: "openai", Tool: "tr", PromptTokens: 200, CompletionTokens: 20, Cost: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// a broken line does not break the report
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{broken\n")
+	f.Close()
+
+	entries, err := Read(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	byModel, err := Summarize(entries, ByModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byModel) != 2 || byModel[0].Key != "gpt-4o:openai" || byModel[0].Chats != 2 || byModel[0].Cost != 1.5 || byModel[0].PromptTokens != 300 {
+		t.Fatalf("unexpected rows by model %+v", byModel)
+	}
+
+	byTool, _ := Summarize(entries, ByTool)
+	if len(byTool) != 2 || byTool[0].Key != "tr" || byTool[1].Key != "-" {
+		t.Fatalf("unexpected rows by tool %+v", byTool)
+	}
+
+	recent, _ := Read(day2)
+	byDay, _ := Summarize(recent, ByDay)
+	if len(byDay) != 1 || byDay[0].Key != "2025-03-02" {
+		t.Fatalf("unexpected rows by day %+v", byDay)
+	}
+
+	if _, err := Summarize(entries, "week"); err == nil {
+		t.Fatal("expected an error for unknown group")
+	}
+}
@@ -2,18 +2,35 @@ package utils
 
 import (
 	"strings"
+	"time"
 
 	"github.com/elsejj/gpt/internal/mcps"
+	"github.com/elsejj/gpt/internal/schema"
+	"github.com/openai/openai-go/v3"
 	"github.com/spf13/viper"
 )
 
 // LLM defines the configuration for a large language model.
+// Provider selects the api protocol, see llm.NewProvider.
 type LLM struct {
 	Gateway      string `yaml:"gateway,omitempty" json:"gateway,omitempty"`
 	ApiKey       string `yaml:"apiKey,omitempty" json:"apiKey,omitempty"`
 	Provider     string `yaml:"provider" json:"provider"`
 	Model        string `yaml:"model" json:"model"`
 	ReasonEffort string `yaml:"reasonEffort,omitempty" json:"reasonEffort,omitempty"`
+	// API selects the api of an OpenAI compatible provider, "chat" (default) or "responses".
+	API string `yaml:"api,omitempty" json:"api,omitempty"`
+	// KeepAlive and NumCtx are options of the ollama provider.
+	KeepAlive string `yaml:"keepAlive,omitempty" json:"keepAlive,omitempty"`
+	NumCtx    int    `yaml:"numCtx,omitempty" json:"numCtx,omitempty"`
+	// Retries is how many times a transient error (429, 5xx, network) is retried, 0 means the default, -1 disables it.
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+	// Fallback are the models tried in order when the retries are exhausted, each one is an alias in 'llms' or 'model[:provider]'.
+	Fallback []string `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+	// NoImages tells the model does not accept images, the images of the tool results are not sent to it.
+	NoImages bool `yaml:"noImages,omitempty" json:"noImages,omitempty"`
+	// Pricing is used to compute the cost of the usage, nil means the cost is unknown.
+	Pricing *Pricing `yaml:"pricing,omitempty" json:"pricing,omitempty"`
 }
 
 // Prompt defines the structure of a user prompt.
@@ -27,13 +44,43 @@ type Prompt struct {
 	OnlyCodeBlock bool
 	Temperature   float64
 	MCPServers    *mcps.MCPs
+	// Schema is the JSON schema which the output must match, it overrides JsonMode.
+	Schema *schema.Schema
+	// History is the conversation before this prompt, after a chat it holds the whole conversation.
+	History []openai.ChatCompletionMessageParamUnion
+	// Usage accumulates the token usage of all chats with this prompt.
+	Usage openai.CompletionUsage
+	// Cost accumulates the cost of all chats with this prompt, in USD.
+	Cost float64
+	// MaxCost and MaxTokens abort a chat when the accumulated cost or total tokens exceed them, zero means no limit.
+	MaxCost   float64
+	MaxTokens int64
+	// Tool is the name of the tool used, it's recorded in the usage ledger.
+	Tool string
+	// Timeout limits a whole chat including the tool calls, ToolTimeout limits each tool call, zero means no limit.
+	Timeout     time.Duration
+	ToolTimeout time.Duration
+	// ToolConcurrency is the max count of tools called at the same time in a round, zero means the default.
+	ToolConcurrency int
+	// MaxToolRounds disables the tools after this count of rounds of tool calls, so the model gives a final answer, zero means no limit.
+	MaxToolRounds int
+	// MaxToolFailures aborts a chat when a tool fails this count of times in a row, zero means no limit.
+	// The failed calls are sent back to the model as errors before that.
+	MaxToolFailures int
+	// ToolFailures accumulates the failed tool calls of all chats with this prompt.
+	ToolFailures int
+	// ApproveTool is asked before a tool call runs, it returns the arguments to call with and whether the call is approved.
+	// Nil approves all the calls.
+	ApproveTool func(name, arguments string) (string, bool, error)
 }
 
 // AppConf defines the application's configuration.
 type AppConf struct {
-	LLM    LLM            `yaml:"llm" json:"llm"`
-	LLMs   map[string]LLM `yaml:"llms,omitempty" json:"llms,omitempty"`
-	Prompt *Prompt
+	LLM  LLM            `yaml:"llm" json:"llm"`
+	LLMs map[string]LLM `yaml:"llms,omitempty" json:"llms,omitempty"`
+	// MCPServers are the MCP servers which can be enabled by name, e.g. '-M github'.
+	MCPServers map[string]mcps.ServerConfig `yaml:"mcpServers,omitempty" json:"mcpServers,omitempty"`
+	Prompt     *Prompt
 }
 
 func parseReasonEffort(effort string) string {
@@ -63,6 +110,7 @@ func (c *AppConf) PickupModel() {
 			// override model and provider are all provided, user want to change model and provider
 			c.LLM.Model = model
 			c.LLM.Provider = provider
+			c.LLM.Pricing = nil
 			if len(reasonEffort) > 0 {
 				c.LLM.ReasonEffort = reasonEffort
 			}
@@ -84,6 +132,13 @@ func (c *AppConf) PickupModel() {
 				if len(llm.Gateway) > 0 {
 					c.LLM.Gateway = llm.Gateway
 				}
+				c.LLM.API = llm.API
+				c.LLM.KeepAlive = llm.KeepAlive
+				c.LLM.NumCtx = llm.NumCtx
+				c.LLM.Retries = llm.Retries
+				c.LLM.Fallback = llm.Fallback
+				c.LLM.Pricing = llm.Pricing
+				c.LLM.NoImages = llm.NoImages
 				if len(reasonEffort) > 0 {
 					c.LLM.ReasonEffort = reasonEffort
 				}
@@ -92,6 +147,7 @@ func (c *AppConf) PickupModel() {
 				// model is not in llms, user just want to change model
 				c.LLM.Model = model
 				c.LLM.Provider = ""
+				c.LLM.Pricing = nil
 				if len(reasonEffort) > 0 {
 					c.LLM.ReasonEffort = reasonEffort
 				}
@@ -102,3 +158,35 @@ func (c *AppConf) PickupModel() {
 		}
 	}
 }
+
+// FallbackLLMs resolves the fallback models of the current model.
+// An alias inherits the gateway and key of the current model if it does not set them, the fallbacks of a fallback are ignored.
+// The reasoning effort is not inherited, as the fallback model may not accept it.
+func (c *AppConf) FallbackLLMs() []LLM {
+	llms := make([]LLM, 0, len(c.LLM.Fallback))
+	for _, name := range c.LLM.Fallback {
+		llm := c.LLM
+		llm.Fallback = nil
+		if alias, ok := c.LLMs[name]; ok {
+			llm.Provider = Or(alias.Provider, llm.Provider)
+			llm.Model = Or(alias.Model, llm.Model)
+			llm.ApiKey = Or(alias.ApiKey, llm.ApiKey)
+			llm.Gateway = Or(alias.Gateway, llm.Gateway)
+			llm.ReasonEffort = alias.ReasonEffort
+			llm.API = alias.API
+			llm.KeepAlive = alias.KeepAlive
+			llm.NumCtx = alias.NumCtx
+			llm.Retries = alias.Retries
+			llm.Pricing = alias.Pricing
+			llm.NoImages = alias.NoImages
+		} else {
+			model, provider, _ := strings.Cut(name, ":")
+			llm.Model = model
+			llm.Provider = provider
+			llm.ReasonEffort = ""
+			llm.Pricing = nil
+		}
+		llms = append(llms, llm)
+	}
+	return llms
+}
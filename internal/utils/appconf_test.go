@@ -0,0 +1,49 @@
+package utils
+
+import "testing"
+
+func TestFallbackLLMs(t *testing.T) {
+	conf := &AppConf{
+		LLM: LLM{Gateway: "https://gw", ApiKey: "key", Provider: "openai", Model: "gpt-4o", ReasonEffort: "high", Fallback: []string{"ds", "gpt-4o-mini", "qwen:ollama", "o3"}},
+		LLMs: map[string]LLM{
+			"ds": {Provider: "deepseek", Model: "deepseek-chat", Retries: 5, Fallback: []string{"loop"}},
+			"o3": {Model: "o3", ReasonEffort: "low", NoImages: true},
+		},
+	}
+
+	llms := conf.FallbackLLMs()
+	if len(llms) != 4 {
+		t.Fatalf("expected 4 fallbacks, got %d", len(llms))
+	}
+	ds := llms[0]
+	if ds.Model != "deepseek-chat" || ds.Provider != "deepseek" || ds.Gateway != "https://gw" || ds.ApiKey != "key" || ds.Retries != 5 || ds.Fallback != nil {
+		t.Fatalf("unexpected alias fallback %+v", ds)
+	}
+	if llms[1].Model != "gpt-4o-mini" || llms[1].Provider != "" {
+		t.Fatalf("unexpected model fallback %+v", llms[1])
+	}
+	if llms[2].Model != "qwen" || llms[2].Provider != "ollama" {
+		t.Fatalf("unexpected model:provider fallback %+v", llms[2])
+	}
+	// the reasoning effort of the current model is not inherited
+	for _, llm := range llms[:3] {
+		if llm.ReasonEffort != "" {
+			t.Fatalf("unexpected reasoning effort of %s: %q", llm.Model, llm.ReasonEffort)
+		}
+	}
+	if llms[3].ReasonEffort != "low" || !llms[3].NoImages || llms[0].NoImages {
+		t.Fatalf("unexpected alias fallback %+v", llms[3])
+	}
+}
+
+func TestPickupModelAlias(t *testing.T) {
+	conf := &AppConf{
+		LLM:    LLM{Model: "gpt-4o"},
+		LLMs:   map[string]LLM{"ds": {Provider: "deepseek", Model: "deepseek-chat", NoImages: true}},
+		Prompt: &Prompt{OverrideModel: "ds"},
+	}
+	conf.PickupModel()
+	if conf.LLM.Model != "deepseek-chat" || conf.LLM.Provider != "deepseek" || !conf.LLM.NoImages {
+		t.Fatalf("unexpected model %+v", conf.LLM)
+	}
+}
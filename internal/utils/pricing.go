@@ -0,0 +1,27 @@
+package utils
+
+import "github.com/openai/openai-go/v3"
+
+// Pricing is the price of a model in USD per million tokens.
+// Cached and Reasoning default to Input and Output when they are not set.
+type Pricing struct {
+	Input     float64 `yaml:"input,omitempty" json:"input,omitempty"`
+	Output    float64 `yaml:"output,omitempty" json:"output,omitempty"`
+	Cached    float64 `yaml:"cached,omitempty" json:"cached,omitempty"`
+	Reasoning float64 `yaml:"reasoning,omitempty" json:"reasoning,omitempty"`
+}
+
+// Cost returns the cost of the usage, the cached tokens are part of the prompt tokens,
+// and the reasoning tokens are part of the completion tokens.
+func (p *Pricing) Cost(usage openai.CompletionUsage) float64 {
+	if p == nil {
+		return 0
+	}
+	cached := usage.PromptTokensDetails.CachedTokens
+	reasoning := usage.CompletionTokensDetails.ReasoningTokens
+	cost := float64(usage.PromptTokens-cached)*p.Input +
+		float64(cached)*Or(p.Cached, p.Input) +
+		float64(usage.CompletionTokens-reasoning)*p.Output +
+		float64(reasoning)*Or(p.Reasoning, p.Output)
+	return cost / 1e6
+}
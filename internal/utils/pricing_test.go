@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+)
+
+func TestPricingCost(t *testing.T) {
+	usage := openai.CompletionUsage{PromptTokens: 1_000_000, CompletionTokens: 500_000}
+	usage.PromptTokensDetails.CachedTokens = 400_000
+	usage.CompletionTokensDetails.ReasoningTokens = 100_000
+
+	p := &Pricing{Input: 2, Output: 8, Cached: 0.5}
+	// 0.6M*2 + 0.4M*0.5 + 0.4M*8 + 0.1M*8 (reasoning defaults to output)
+	if got := p.Cost(usage); math.Abs(got-5.4) > 1e-9 {
+		t.Fatalf("unexpected cost %v", got)
+	}
+
+	var unknown *Pricing
+	if got := unknown.Cost(usage); got != 0 {
+		t.Fatalf("expected no cost without pricing, got %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultStdinLimit is the default max size of the content read from stdin.
+const DefaultStdinLimit = 1 << 20
+
+// stdinPlaceholder matches `@-` or `${STDIN}`, where the stdin content is placed in the prompt.
+var stdinPlaceholder = regexp.MustCompile(`@-\B|\$\{STDIN\}`)
+
+// HasStdin reports whether stdin is a pipe or a file instead of a terminal.
+func HasStdin() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// OpenTerminal opens the controlling terminal, the answers of the user are read from it when stdin is consumed by the prompt.
+func OpenTerminal() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.Open("CONIN$")
+	}
+	return os.Open("/dev/tty")
+}
+
+// ReadInput reads all text from r, it fails when the content is larger than limit bytes or is binary.
+func ReadInput(r io.Reader, limit int64) (string, error) {
+	if limit <= 0 {
+		limit = DefaultStdinLimit
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > limit {
+		return "", fmt.Errorf("stdin is larger than %d bytes, raise it with --stdin-limit", limit)
+	}
+	if bytes.IndexByte(body, 0) >= 0 || !utf8.Valid(body) {
+		return "", fmt.Errorf("stdin looks like binary data (%s), only text is supported", http.DetectContentType(body))
+	}
+	return string(body), nil
+}
+
+// WithStdin places input into prompt as a fenced block.
+// The block replaces the `@-` or `${STDIN}` placeholders, or is appended to the prompt if there is none.
+func WithStdin(prompt string, input string) string {
+	if strings.TrimSpace(input) == "" {
+		return prompt
+	}
+	block := fencedBlock(input)
+	if stdinPlaceholder.MatchString(prompt) {
+		return stdinPlaceholder.ReplaceAllLiteralString(prompt, block)
+	}
+	prompt = strings.TrimRight(prompt, " \n")
+	if prompt == "" {
+		return block
+	}
+	return prompt + "\n\n" + block
+}
+
+// fencedBlock wraps content in a code fence, which is longer than any backtick run in the content.
+func fencedBlock(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + "\n" + strings.TrimRight(content, "\n") + "\n" + fence
+}
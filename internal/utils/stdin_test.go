@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithStdinAppendsFencedBlock(t *testing.T) {
+	got := WithStdin("review this ", "diff --git a b\n")
+	want := "review this\n\n```\ndiff --git a b\n```"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWithStdinReplacesPlaceholders(t *testing.T) {
+	got := WithStdin("before @- middle ${STDIN} after", "x")
+	want := "before ```\nx\n``` middle ```\nx\n``` after"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if got := WithStdin("mail to a@-b", "x"); !strings.HasPrefix(got, "mail to a@-b\n\n") {
+		t.Fatalf("placeholder inside a word should be kept, got %q", got)
+	}
+}
+
+func TestWithStdinUsesLongerFence(t *testing.T) {
+	got := WithStdin("", "```go\nfmt.Println()\n```")
+	if !strings.HasPrefix(got, "````\n") || !strings.HasSuffix(got, "\n````") {
+		t.Fatalf("expected a 4 backticks fence, got %q", got)
+	}
+}
+
+func TestReadInputLimitAndBinary(t *testing.T) {
+	if _, err := ReadInput(strings.NewReader("12345"), 4); err == nil {
+		t.Fatal("expected error for input larger than limit")
+	}
+	if got, err := ReadInput(strings.NewReader("1234"), 4); err != nil || got != "1234" {
+		t.Fatalf("expected input within limit, got %q, %v", got, err)
+	}
+	_, err := ReadInput(strings.NewReader("\x89PNG\r\n\x1a\n\x00\x00"), 100)
+	if err == nil || !strings.Contains(err.Error(), "binary") {
+		t.Fatalf("expected binary error, got %v", err)
+	}
+}
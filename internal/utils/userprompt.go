@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"context"
+	"log/slog"
 	"os"
 	"regexp"
 	"runtime"
@@ -31,7 +33,7 @@ func SplitContentAndVariables(args []string) ([]string, map[string]string) {
 }
 
 // UserPrompt processes the user's prompt.
-// It reads files, gets MCP prompts, and replaces variables.
+// It reads files, gets MCP prompts and resources, and replaces variables.
 func UserPrompt(variables map[string]string, args ...string) string {
 
 	var buf strings.Builder
@@ -70,10 +72,18 @@ func UserPrompt(variables map[string]string, args ...string) string {
 
 	all := buf.String()
 
-	// replace all word starts with @ to file content
+	// replace all word starts with @ to file content, or the resource of a mcp server with @mcp:<uri>
 	r := regexp.MustCompile(`@([^\s]+)`)
 	all = r.ReplaceAllStringFunc(all, func(s string) string {
 		filePath := strings.TrimPrefix(s, "@")
+		if uri, ok := strings.CutPrefix(filePath, "mcp:"); ok {
+			content, err := mcps.ReadResource(context.Background(), uri)
+			if err != nil {
+				slog.Warn("failed to read mcp resource", "uri", uri, "error", err)
+				return s
+			}
+			return content
+		}
 		content, err := os.ReadFile(filePath)
 		if err != nil {
 			return s
@@ -93,6 +103,12 @@ var globalVariables = map[string]string{
 	"SHELL": shellName(),
 }
 
+// IsGlobalVariable reports whether name is a variable provided by the app, such as OS and TODAY.
+func IsGlobalVariable(name string) bool {
+	_, ok := globalVariables[name]
+	return ok
+}
+
 // shellName returns the name of the current shell.
 func shellName() string {
 	if runtime.GOOS == "windows" {
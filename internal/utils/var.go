@@ -16,3 +16,17 @@ func ExpandVariables(s string, variables ...map[string]string) string {
 		return match
 	})
 }
+
+// VariableNames returns the names of the ${name} placeholders in s, in the order they first appear.
+func VariableNames(s string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range variableRegex.FindAllString(s, -1) {
+		name := match[2 : len(match)-1]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}